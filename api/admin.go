@@ -0,0 +1,172 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"designs.capital/dogepool/pool"
+)
+
+type PoolAdmin interface {
+	BannedIPs() []pool.Ban
+	BanIP(ip, reason string, duration time.Duration) error
+	UnbanIP(ip string) error
+	Reconnect(sessionID, minerAddress, workerName, host, port string, wait int) (int, error)
+	ShowMessage(sessionID, minerAddress, workerName, message string) (int, error)
+	ReassignExtranonce(sessionID string) error
+}
+
+var poolAdmin PoolAdmin
+
+func authorizedAdmin(response http.ResponseWriter, request *http.Request) bool {
+	adminKey := serverConfig.API.AdminKey
+	requestKey := request.Header.Get("X-Admin-Key")
+	if subtle.ConstantTimeCompare([]byte(adminKey), []byte(requestKey)) != 1 {
+		http.Error(response, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// GET lists bans, POST ?ip=&duration=&reason= bans, DELETE ?ip= unbans
+func adminBans(response http.ResponseWriter, request *http.Request) {
+	if !authorizedAdmin(response, request) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	ip := request.URL.Query().Get("ip")
+
+	var err error
+	switch request.Method {
+	case http.MethodGet:
+		err = json.NewEncoder(response).Encode(poolAdmin.BannedIPs())
+	case http.MethodPost:
+		var duration time.Duration
+		duration, err = time.ParseDuration(request.URL.Query().Get("duration"))
+		if err != nil || ip == "" {
+			http.Error(response, "ip and duration are required", http.StatusBadRequest)
+			return
+		}
+		reason := request.URL.Query().Get("reason")
+		if reason == "" {
+			reason = "banned by admin"
+		}
+		err = poolAdmin.BanIP(ip, reason, duration)
+	case http.MethodDelete:
+		if ip == "" {
+			http.Error(response, "ip is required", http.StatusBadRequest)
+			return
+		}
+		err = poolAdmin.UnbanIP(ip)
+	default:
+		http.Error(response, fmt.Sprintf("method %s is not allowed", request.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// POST ?session=&miner=&worker=&host=&port=&wait=, without session or miner every miner is told
+func adminReconnect(response http.ResponseWriter, request *http.Request) {
+	if !authorizedAdmin(response, request) {
+		return
+	}
+	if request.Method != http.MethodPost {
+		http.Error(response, fmt.Sprintf("method %s is not allowed", request.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	if query.Get("worker") != "" && query.Get("miner") == "" {
+		http.Error(response, "miner is required with worker", http.StatusBadRequest)
+		return
+	}
+	host, port := query.Get("host"), query.Get("port")
+	if host != "" && port == "" {
+		http.Error(response, "port is required with host", http.StatusBadRequest)
+		return
+	}
+
+	wait := 0
+	if query.Get("wait") != "" {
+		var err error
+		wait, err = strconv.Atoi(query.Get("wait"))
+		if err != nil || wait < 0 {
+			http.Error(response, "wait must be a number of seconds", http.StatusBadRequest)
+			return
+		}
+	}
+	if host == "" && wait != 0 {
+		http.Error(response, "wait is only sent with a host", http.StatusBadRequest)
+		return
+	}
+
+	sent, err := poolAdmin.Reconnect(query.Get("session"), query.Get("miner"), query.Get("worker"), host, port, wait)
+	writeAdminSent(response, sent, err)
+}
+
+// POST ?session=&miner=&worker=&message=, targets sessions like adminReconnect
+func adminMessage(response http.ResponseWriter, request *http.Request) {
+	if !authorizedAdmin(response, request) {
+		return
+	}
+	if request.Method != http.MethodPost {
+		http.Error(response, fmt.Sprintf("method %s is not allowed", request.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	if query.Get("worker") != "" && query.Get("miner") == "" {
+		http.Error(response, "miner is required with worker", http.StatusBadRequest)
+		return
+	}
+	message := query.Get("message")
+	if message == "" {
+		http.Error(response, "message is required", http.StatusBadRequest)
+		return
+	}
+
+	sent, err := poolAdmin.ShowMessage(query.Get("session"), query.Get("miner"), query.Get("worker"), message)
+	writeAdminSent(response, sent, err)
+}
+
+// POST ?session=, moves a session that sent mining.extranonce.subscribe to a new extranonce1
+func adminExtranonce(response http.ResponseWriter, request *http.Request) {
+	if !authorizedAdmin(response, request) {
+		return
+	}
+	if request.Method != http.MethodPost {
+		http.Error(response, fmt.Sprintf("method %s is not allowed", request.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID := request.URL.Query().Get("session")
+	if sessionID == "" {
+		http.Error(response, "session is required", http.StatusBadRequest)
+		return
+	}
+
+	err := poolAdmin.ReassignExtranonce(sessionID)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response.WriteHeader(http.StatusNoContent)
+}
+
+func writeAdminSent(response http.ResponseWriter, sent int, err error) {
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(map[string]int{"sessions": sent})
+}
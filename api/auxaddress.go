@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"designs.capital/dogepool/pool"
+)
+
+type AuxAddressRegistrar interface {
+	RegisterAuxAddress(primaryAddress, chain, auxAddress, signature string, signedAt int64) error
+}
+
+var auxAddresses AuxAddressRegistrar
+
+// Every registration attempt costs the primary node a verifymessage
+const auxAddressAttemptsPerMinute = 5
+
+var auxAddressAttempts = struct {
+	sync.Mutex
+	windowStart time.Time
+	counts      map[string]int // IP => POSTs this minute
+}{counts: make(map[string]int)}
+
+// Counts start over every minute, so the map only ever holds a minute of IPs
+func allowAuxAddressAttempt(ip string, now time.Time) bool {
+	auxAddressAttempts.Lock()
+	defer auxAddressAttempts.Unlock()
+
+	if now.Sub(auxAddressAttempts.windowStart) >= time.Minute {
+		auxAddressAttempts.windowStart = now
+		auxAddressAttempts.counts = make(map[string]int)
+	}
+	auxAddressAttempts.counts[ip]++
+	return auxAddressAttempts.counts[ip] <= auxAddressAttemptsPerMinute
+}
+
+// GET ?chain=&address= returns the message to sign with the primary address and its timestamp,
+// POST ?miner=&chain=&address=&timestamp=&signature= registers it
+func minerAuxAddress(response http.ResponseWriter, request *http.Request) {
+	chain := request.FormValue("chain")
+	address := request.FormValue("address")
+	if chain == "" || address == "" {
+		http.Error(response, "chain and address are required", http.StatusBadRequest)
+		return
+	}
+
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+
+	switch request.Method {
+	case http.MethodGet:
+		response.Header().Set("Content-Type", "application/json")
+		timestamp := time.Now().Unix()
+		json.NewEncoder(response).Encode(map[string]interface{}{
+			"message":   pool.AuxAddressMessage(serverConfig.PoolName, chain, address, timestamp),
+			"timestamp": timestamp,
+		})
+	case http.MethodPost:
+		ip, _, err := net.SplitHostPort(request.RemoteAddr)
+		if err != nil {
+			ip = request.RemoteAddr
+		}
+		if !allowAuxAddressAttempt(ip, time.Now()) {
+			http.Error(response, "too many registration attempts, try again in a minute", http.StatusTooManyRequests)
+			return
+		}
+
+		miner := request.FormValue("miner")
+		signature := request.FormValue("signature")
+		timestamp, err := strconv.ParseInt(request.FormValue("timestamp"), 10, 64)
+		if miner == "" || signature == "" || err != nil {
+			http.Error(response, "miner, timestamp and signature are required", http.StatusBadRequest)
+			return
+		}
+
+		err = auxAddresses.RegisterAuxAddress(miner, chain, address, signature, timestamp)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(response, fmt.Sprintf("method %s is not allowed", request.Method), http.StatusMethodNotAllowed)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"designs.capital/dogepool/config"
+	"designs.capital/dogepool/pool"
 )
 
 const JavascriptISOFormat = "2006-01-02T15:04:05.999Z07:00"
@@ -56,12 +57,48 @@ func poolIndex(response http.ResponseWriter, request *http.Request) {
 
 var serverConfig *config.Config
 
-func ListenAndServe(configuration *config.Config) {
+// What the API needs from the running pool server
+type PoolService interface {
+	PoolAdmin
+	AuxAddressRegistrar
+	LiveHashrate(miner string) pool.LiveHashrate
+}
+
+var poolService PoolService
+
+// Straight from the stratum server, no database round trip. ?miner= for one miner's workers
+func liveHashrate(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(response, fmt.Sprintf("method %s is not allowed", request.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	err := json.NewEncoder(response).Encode(poolService.LiveHashrate(request.URL.Query().Get("miner")))
+	if err != nil {
+		http.Error(response, fmt.Sprintf("error building the response, %v", err), http.StatusInternalServerError)
+	}
+}
+
+func ListenAndServe(configuration *config.Config, service PoolService) {
 	serverConfig = configuration
+	poolService = service
+	poolAdmin = service
+	auxAddresses = service
 
 	http.HandleFunc("/miner", minerIndex)
 	http.HandleFunc("/miner-history", minerHistory)
+	http.HandleFunc("/miner/aux-address", minerAuxAddress)
 	http.HandleFunc("/pool", poolIndex)
+	http.HandleFunc("/live-hashrate", liveHashrate)
+
+	if configuration.API.AdminKey != "" {
+		http.HandleFunc("/admin/bans", adminBans)
+		http.HandleFunc("/admin/reconnect", adminReconnect)
+		http.HandleFunc("/admin/message", adminMessage)
+		http.HandleFunc("/admin/extranonce", adminExtranonce)
+	}
 
 	log.Fatal(http.ListenAndServe(":"+configuration.API.Port, nil))
 }
@@ -0,0 +1,313 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// What a chain's addresses look like on one network, I.e. "main", "test" or "regtest"
+type AddressFormat struct {
+	PubKeyHash byte   // Base58 version byte for P2PKH
+	ScriptHash []byte // Base58 version bytes for P2SH, some chains still accept an old one
+	Bech32HRP  string // Empty for chains without segwit
+	CashAddr   string // Bitcoin Cash's cashaddr prefix, I.e. "bitcoincash"
+}
+
+var errUnknownNetwork = errors.New("unknown network")
+
+// Script a payment to address is locked with, as coinbase outputs want it
+func AddressScript(chain Blockchain, network, address string) (string, error) {
+	format, err := chain.AddressFormat(network)
+	if err != nil {
+		return "", fmt.Errorf("%v %v: %w", chain.ChainName(), network, err)
+	}
+
+	script, err := DecodeAddress(format, address)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(script), nil
+}
+
+func ValidAddress(chain Blockchain, network, address string) bool {
+	_, err := AddressScript(chain, network, address)
+	return err == nil
+}
+
+// Strictly decodes a P2PKH, P2SH, P2WPKH, P2WSH or P2TR address to its scriptPubKey
+func DecodeAddress(format AddressFormat, address string) ([]byte, error) {
+	if format.Bech32HRP != "" && strings.HasPrefix(strings.ToLower(address), format.Bech32HRP+"1") {
+		return decodeSegwitAddress(format.Bech32HRP, address)
+	}
+	// Base58 versions for these chains never start with q or p, so a cashaddr without its prefix is unambiguous
+	if format.CashAddr != "" && (strings.Contains(address, ":") || strings.IndexAny(address, "qpQP") == 0) {
+		return decodeCashAddress(format.CashAddr, address)
+	}
+
+	version, hash, err := decodeBase58Check(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(hash) != 20 {
+		return nil, errors.New("base58 address hash must be 20 bytes: " + address)
+	}
+
+	if version == format.PubKeyHash {
+		return p2pkhScript(hash), nil
+	}
+	if bytes.IndexByte(format.ScriptHash, version) >= 0 {
+		return p2shScript(hash), nil
+	}
+
+	return nil, fmt.Errorf("address version %#02x is for another chain or network: %v", version, address)
+}
+
+func p2pkhScript(hash []byte) []byte {
+	script := []byte{0x76, 0xa9, 0x14} // OP_DUP OP_HASH160 <20>
+	script = append(script, hash...)
+	return append(script, 0x88, 0xac) // OP_EQUALVERIFY OP_CHECKSIG
+}
+
+func p2shScript(hash []byte) []byte {
+	script := []byte{0xa9, 0x14} // OP_HASH160 <20>
+	script = append(script, hash...)
+	return append(script, 0x87) // OP_EQUAL
+}
+
+// Version 0 is OP_0, 1 through 16 are OP_1 onward
+func witnessScript(version byte, program []byte) []byte {
+	opcode := version
+	if version > 0 {
+		opcode = 0x50 + version
+	}
+	script := []byte{opcode, byte(len(program))}
+	return append(script, program...)
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func decodeBase58Check(address string) (byte, []byte, error) {
+	if address == "" {
+		return 0, nil, errors.New("empty address")
+	}
+
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, character := range address {
+		digit := strings.IndexRune(base58Alphabet, character)
+		if digit < 0 {
+			return 0, nil, errors.New("invalid base58 character in address: " + address)
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	// Leading 1s are leading zero bytes
+	zeros := len(address) - len(strings.TrimLeft(address, "1"))
+	decoded := append(make([]byte, zeros), value.Bytes()...)
+	if len(decoded) < 5 {
+		return 0, nil, errors.New("address too short: " + address)
+	}
+
+	payload, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	expected := doubleSha256Bytes(payload)
+	if !bytes.Equal(checksum, expected[:4]) {
+		return 0, nil, errors.New("bad address checksum: " + address)
+	}
+
+	return payload[0], payload[1:], nil
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0173.mediawiki
+// https://github.com/bitcoin/bips/blob/master/bip-0350.mediawiki
+const (
+	bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32Const    = 1
+	bech32mConst   = 0x2bc830a3
+	bech32MaxLen   = 90
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for _, character := range []byte(hrp) {
+		expanded = append(expanded, character>>5)
+	}
+	expanded = append(expanded, 0)
+	for _, character := range []byte(hrp) {
+		expanded = append(expanded, character&31)
+	}
+	return expanded
+}
+
+// Returns the hrp, the data without its checksum, and which checksum constant matched
+func decodeBech32(address string) (string, []byte, uint32, error) {
+	if len(address) > bech32MaxLen {
+		return "", nil, 0, errors.New("bech32 address too long: " + address)
+	}
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return "", nil, 0, errors.New("mixed case bech32 address: " + address)
+	}
+	address = strings.ToLower(address)
+
+	separator := strings.LastIndexByte(address, '1')
+	if separator < 1 || separator+7 > len(address) {
+		return "", nil, 0, errors.New("malformed bech32 address: " + address)
+	}
+	hrp := address[:separator]
+
+	data := make([]byte, 0, len(address)-separator-1)
+	for _, character := range address[separator+1:] {
+		value := strings.IndexRune(bech32Alphabet, character)
+		if value < 0 {
+			return "", nil, 0, errors.New("invalid bech32 character in address: " + address)
+		}
+		data = append(data, byte(value))
+	}
+
+	constant := bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	if constant != bech32Const && constant != bech32mConst {
+		return "", nil, 0, errors.New("bad address checksum: " + address)
+	}
+
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// Regroups 5 bit words into bytes, leftover bits must be zero padding
+func convertBitsFrom5(data []byte) ([]byte, error) {
+	var accumulator uint32
+	var bits uint
+	var converted []byte
+	for _, value := range data {
+		accumulator = accumulator<<5 | uint32(value)
+		bits += 5
+		for bits >= 8 {
+			bits -= 8
+			converted = append(converted, byte(accumulator>>bits))
+		}
+	}
+	if bits >= 5 || (accumulator<<(8-bits))&0xff != 0 {
+		return nil, errors.New("invalid bech32 padding")
+	}
+	return converted, nil
+}
+
+func decodeSegwitAddress(expectedHRP, address string) ([]byte, error) {
+	hrp, data, constant, err := decodeBech32(address)
+	if err != nil {
+		return nil, err
+	}
+	if hrp != expectedHRP {
+		return nil, errors.New("address is for another chain or network: " + address)
+	}
+	if len(data) < 1 {
+		return nil, errors.New("segwit address without a witness version: " + address)
+	}
+
+	version := data[0]
+	program, err := convertBitsFrom5(data[1:])
+	if err != nil {
+		return nil, errors.New(err.Error() + ": " + address)
+	}
+
+	// Version 0 uses the original bech32 checksum, everything after uses bech32m
+	switch {
+	case version == 0 && constant != bech32Const, version > 0 && constant != bech32mConst:
+		return nil, errors.New("wrong bech32 checksum variant for witness version: " + address)
+	case version == 0 && (len(program) == 20 || len(program) == 32): // P2WPKH, P2WSH
+	case version == 1 && len(program) == 32: // P2TR
+	default:
+		return nil, fmt.Errorf("unsupported witness version %v program of %v bytes: %v", version, len(program), address)
+	}
+
+	return witnessScript(version, program), nil
+}
+
+// https://github.com/bitcoincashorg/bitcoincash.org/blob/master/spec/cashaddr.md
+func cashAddrPolymod(values []byte) uint64 {
+	generator := []uint64{0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470}
+	checksum := uint64(1)
+	for _, value := range values {
+		top := checksum >> 35
+		checksum = (checksum&0x07ffffffff)<<5 ^ uint64(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum ^ 1
+}
+
+// The prefix is optional, only 20 byte P2PKH and P2SH hashes are supported
+func decodeCashAddress(expectedPrefix, address string) ([]byte, error) {
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return nil, errors.New("mixed case cashaddr: " + address)
+	}
+	lowered := strings.ToLower(address)
+
+	prefix, payload, found := strings.Cut(lowered, ":")
+	if !found {
+		prefix, payload = expectedPrefix, lowered
+	}
+	if prefix != expectedPrefix {
+		return nil, errors.New("address is for another chain or network: " + address)
+	}
+	if len(payload) < 9 {
+		return nil, errors.New("malformed cashaddr: " + address)
+	}
+
+	data := make([]byte, 0, len(payload))
+	for _, character := range payload {
+		value := strings.IndexRune(bech32Alphabet, character)
+		if value < 0 {
+			return nil, errors.New("invalid cashaddr character in address: " + address)
+		}
+		data = append(data, byte(value))
+	}
+
+	checked := make([]byte, 0, len(prefix)+1+len(data))
+	for _, character := range []byte(prefix) {
+		checked = append(checked, character&31)
+	}
+	checked = append(append(checked, 0), data...)
+	if cashAddrPolymod(checked) != 0 {
+		return nil, errors.New("bad address checksum: " + address)
+	}
+
+	decoded, err := convertBitsFrom5(data[:len(data)-8])
+	if err != nil {
+		return nil, errors.New(err.Error() + ": " + address)
+	}
+	if len(decoded) != 21 {
+		return nil, errors.New("unsupported cashaddr hash size: " + address)
+	}
+
+	switch version, hash := decoded[0], decoded[1:]; version {
+	case 0x00:
+		return p2pkhScript(hash), nil
+	case 0x08:
+		return p2shScript(hash), nil
+	default:
+		return nil, fmt.Errorf("unsupported cashaddr version %#02x: %v", version, address)
+	}
+}
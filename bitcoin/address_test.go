@@ -0,0 +1,70 @@
+package bitcoin
+
+import "testing"
+
+// Every address is the same hash160 751e76e8.. or the BIP173 P2WSH program 1863143c.., encoded with each network's versions
+func TestAddressScript(t *testing.T) {
+	p2pkh := "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"
+	p2sh := "a914751e76e8199196d454941c45d1b3a323f1433bd687"
+	p2wpkh := "0014751e76e8199196d454941c45d1b3a323f1433bd6"
+	p2wsh := "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"
+	p2tr := "51201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"
+
+	tests := []struct {
+		chain, network, address, script string
+	}{
+		{"litecoin", "main", "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ", p2pkh},
+		{"litecoin", "main", "MJaRnao1s62a2zAKSkmG582KbLKianqb7v", p2sh},
+		{"litecoin", "main", "3CNHUhP3uyB9EUtRLsmvFUmvGdjGdkTxJw", p2sh}, // The old P2SH version is still accepted
+		{"litecoin", "main", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9", p2wpkh},
+		{"litecoin", "main", "LTC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KGMN4N9", p2wpkh},
+		{"litecoin", "main", "ltc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qmu8tk5", p2wsh},
+		{"litecoin", "main", "ltc1prp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q3t8zwg", p2tr},
+		{"litecoin", "test", "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", p2pkh},
+		{"litecoin", "test", "QXHFfTBKYXjaaTH1e7Rox8CcdNPGHVhM59", p2sh},
+		{"litecoin", "test", "tltc1qw508d6qejxtdg4y5r3zarvary0c5xw7klfsuq0", p2wpkh},
+		{"litecoin", "test", "tltc1prp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q6yru3a", p2tr},
+		{"litecoin", "regtest", "rltc1qw508d6qejxtdg4y5r3zarvary0c5xw7k693xs3", p2wpkh},
+		{"dogecoin", "main", "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLE", p2pkh},
+		{"dogecoin", "main", "A37YDYSwz3438rFtm1SLVcQHyD7JeueC9H", p2sh},
+		{"dogecoin", "test", "nesRpRaAbTDmZHwmzBkLd2AtF7Z9L9z5S2", p2pkh},
+		{"dogecoin", "regtest", "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", p2pkh},
+	}
+
+	for _, test := range tests {
+		script, err := AddressScript(GetChain(test.chain), test.network, test.address)
+		if err != nil || script != test.script {
+			t.Errorf("%v %v %v: script %v, %v", test.chain, test.network, test.address, script, err)
+		}
+	}
+}
+
+func TestAddressScriptErrors(t *testing.T) {
+	tests := []struct {
+		name, chain, network, address string
+	}{
+		{"base58 checksum", "dogecoin", "main", "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLF"},
+		{"base58 character", "dogecoin", "main", "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZL0"},
+		{"bech32 checksum", "litecoin", "main", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n8"},
+		{"mixed case", "litecoin", "main", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmN4n9"},
+		{"testnet on main", "litecoin", "main", "tltc1qw508d6qejxtdg4y5r3zarvary0c5xw7klfsuq0"},
+		{"mainnet on test", "litecoin", "test", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9"},
+		{"dogecoin testnet on main", "dogecoin", "main", "nesRpRaAbTDmZHwmzBkLd2AtF7Z9L9z5S2"},
+		{"dogecoin on litecoin", "litecoin", "main", "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLE"},
+		{"litecoin on dogecoin", "dogecoin", "main", "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ"},
+		{"segwit on dogecoin", "dogecoin", "main", "doge1qw508d6qejxtdg4y5r3zarvary0c5xw7k0axcqs"},
+		{"version 0 with a bech32m checksum", "litecoin", "main", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7ka8rek8"},
+		{"version 1 with a bech32 checksum", "litecoin", "main", "ltc1prp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qyhhwt2"},
+		{"witness version 17", "litecoin", "main", "ltc13w508d6qejxtdg4y5r3zarvary0c5xw7kz49x5c"},
+		{"version 0 program of 21 bytes", "litecoin", "main", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kqq4dff0f"},
+		{"unknown network", "litecoin", "signet", "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ"},
+		{"empty", "litecoin", "main", ""},
+	}
+
+	for _, test := range tests {
+		script, err := AddressScript(GetChain(test.chain), test.network, test.address)
+		if err == nil {
+			t.Errorf("%v: %v decoded to %v", test.name, test.address, script)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package bitcoin
+
+import "math"
+
+// A header proof of work, and how a pool's share difficulty maps onto it
+type Algorithm struct {
+	Name   string
+	Digest func(header string) (string, error)
+	// Stratum difficulty 1 is this many times easier than the 00000000ffff.. difficulty 1
+	ShareMultiplier float64
+	// Shares are weighed after ShareMultiplier, this is the average hashes behind each 1 of that
+	HashesPerDifficulty float64
+}
+
+var algorithms = map[string]Algorithm{
+	"sha256d": {
+		Name:                "sha256d",
+		Digest:              DoubleSha256,
+		ShareMultiplier:     1,
+		HashesPerDifficulty: math.Pow(2, 32),
+	},
+	"scrypt": {
+		Name:                "scrypt",
+		Digest:              ScryptDigest,
+		ShareMultiplier:     65536,
+		HashesPerDifficulty: math.Pow(2, 32),
+	},
+}
+
+func GetAlgorithm(name string) (Algorithm, bool) {
+	algorithm, exists := algorithms[name]
+	return algorithm, exists
+}
+
+// Converts the accepted difficulty of a chain's shares to hashes
+func HashesPerDifficulty(chain Blockchain) float64 {
+	algorithm, exists := GetAlgorithm(chain.HeaderAlgorithm())
+	if !exists {
+		panic("Unknown header algorithm: " + chain.HeaderAlgorithm())
+	}
+	return algorithm.HashesPerDifficulty
+}
@@ -1,10 +1,17 @@
 package bitcoin
 
-import "fmt"
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
 
+// https://en.bitcoin.it/wiki/Merged_mining_specification
 const (
-	mergedMiningHeader  = "fabe6d6d"
-	mergedMiningTrailer = "010000000000000000002632"
+	mergedMiningHeader   = "fabe6d6d"
+	maxAuxMerkleHeight   = 8 // 256 slots, far more than anyone merges
+	auxMerkleNonceTrials = 1000
 )
 
 type AuxBlock struct {
@@ -16,10 +23,114 @@ type AuxBlock struct {
 	Bits              string `json:"bits"`
 	Height            uint64 `json:"height"`
 	Target            string `json:"target"`
+	ChainName         string `json:"-"` // Which of our aux chains this came from
+}
+
+// Every aux block hash at its chain's slot, committed to by one root in the parent coinbase
+type AuxMerkleTree struct {
+	Size   uint32
+	Nonce  uint32
+	slots  []uint32   // Per aux block, in the order given to MakeAuxMerkleTree
+	levels [][][]byte // Leaves first, the root last
+}
+
+// Where a chain expects its hash, the LCG from Namecoin's getExpectedIndex
+func auxMerkleSlot(nonce uint32, chainID int, size uint32) uint32 {
+	random := nonce
+	random = random*1103515245 + 12345
+	random += uint32(chainID)
+	random = random*1103515245 + 12345
+	return random % size
+}
+
+// Finds the smallest tree, and a nonce, where no two chains share a slot
+func MakeAuxMerkleTree(auxBlocks []AuxBlock) (*AuxMerkleTree, error) {
+	chainIDs := make(map[int]bool)
+	for _, auxBlock := range auxBlocks {
+		if chainIDs[auxBlock.ChainID] {
+			return nil, fmt.Errorf("two aux chains share chain ID %v", auxBlock.ChainID)
+		}
+		chainIDs[auxBlock.ChainID] = true
+	}
+
+	for height := 0; height <= maxAuxMerkleHeight; height++ {
+		size := uint32(1) << height
+		if int(size) < len(auxBlocks) {
+			continue
+		}
+		for nonce := uint32(0); nonce < auxMerkleNonceTrials; nonce++ {
+			slots, unique := auxMerkleSlots(auxBlocks, nonce, size)
+			if unique {
+				return buildAuxMerkleTree(auxBlocks, slots, nonce, size)
+			}
+		}
+	}
+
+	return nil, errors.New("no aux merkle tree fits these chain IDs")
 }
 
-func (b *AuxBlock) GetWork() string {
-	return mergedMiningHeader + b.Hash + mergedMiningTrailer
+func auxMerkleSlots(auxBlocks []AuxBlock, nonce, size uint32) ([]uint32, bool) {
+	taken := make(map[uint32]bool)
+	slots := make([]uint32, len(auxBlocks))
+	for i, auxBlock := range auxBlocks {
+		slots[i] = auxMerkleSlot(nonce, auxBlock.ChainID, size)
+		if taken[slots[i]] {
+			return nil, false
+		}
+		taken[slots[i]] = true
+	}
+	return slots, true
+}
+
+func buildAuxMerkleTree(auxBlocks []AuxBlock, slots []uint32, nonce, size uint32) (*AuxMerkleTree, error) {
+	leaves := make([][]byte, size)
+	for i := range leaves {
+		leaves[i] = make([]byte, 32) // Unused slots
+	}
+	for i, auxBlock := range auxBlocks {
+		hash, err := hex.DecodeString(auxBlock.Hash)
+		if err != nil || len(hash) != 32 {
+			return nil, errors.New("invalid aux block hash: " + auxBlock.Hash)
+		}
+		leaves[slots[i]] = reverse(hash) // RPC hashes are displayed reversed
+	}
+
+	tree := &AuxMerkleTree{
+		Size:   size,
+		Nonce:  nonce,
+		slots:  slots,
+		levels: [][][]byte{leaves},
+	}
+	for level := leaves; len(level) > 1; {
+		parents := make([][]byte, len(level)/2)
+		for i := range parents {
+			joined := doubleSha256Bytes(append(append([]byte{}, level[2*i]...), level[2*i+1]...))
+			parents[i] = joined[:]
+		}
+		tree.levels = append(tree.levels, parents)
+		level = parents
+	}
+
+	return tree, nil
+}
+
+// The parent coinbase's merged mining commitment: header, root, size and nonce
+func (t *AuxMerkleTree) Commitment() string {
+	root := t.levels[len(t.levels)-1][0]
+	sizeAndNonce := binary.LittleEndian.AppendUint32(nil, t.Size)
+	sizeAndNonce = binary.LittleEndian.AppendUint32(sizeAndNonce, t.Nonce)
+	return mergedMiningHeader + hex.EncodeToString(reverse(root)) + hex.EncodeToString(sizeAndNonce)
+}
+
+func (t *AuxMerkleTree) branch(auxIndex int) AuxMerkleBranch {
+	slot := t.slots[auxIndex]
+	branch := AuxMerkleBranch{index: slot}
+	position := slot
+	for _, level := range t.levels[:len(t.levels)-1] {
+		branch.items = append(branch.items, hex.EncodeToString(level[position^1]))
+		position >>= 1
+	}
+	return branch
 }
 
 type AuxPow struct {
@@ -30,17 +141,18 @@ type AuxPow struct {
 	ParentHeaderUnhashed string
 }
 
-func MakeAuxPow(parentBlock BitcoinBlock) AuxPow {
+// Proof for the aux block at auxIndex of the tree the parent block committed to
+func MakeAuxPow(parentBlock BitcoinBlock, tree *AuxMerkleTree, auxIndex int) AuxPow {
 	if parentBlock.hash == "" {
 		panic("Set parent block hash first")
 	}
-	// debugAuxPow(parentBlock, makeParentMerkleBranch(parentBlock.merkleSteps), makeAuxChainMerkleBranch())
+	// debugAuxPow(parentBlock, makeParentMerkleBranch(parentBlock.merkleSteps), tree.branch(auxIndex))
 
 	return AuxPow{
 		ParentCoinbase:       parentBlock.coinbase,
 		ParentHeaderHash:     parentBlock.hash,
 		ParentMerkleBranch:   makeParentMerkleBranch(parentBlock.merkleSteps),
-		auxMerkleBranch:      makeAuxChainMerkleBranch(),
+		auxMerkleBranch:      tree.branch(auxIndex),
 		ParentHeaderUnhashed: parentBlock.header,
 	}
 }
@@ -77,19 +189,16 @@ func (pm *ParentMerkleBranch) Serialize() string {
 }
 
 type AuxMerkleBranch struct {
-	numberOfBranches string
-	mask             string
-}
-
-func makeAuxChainMerkleBranch() AuxMerkleBranch {
-	return AuxMerkleBranch{
-		numberOfBranches: "00",
-		mask:             "00000000",
-	}
+	items []string
+	index uint32 // The chain's slot, its bits pick left or right at each level
 }
 
 func (am *AuxMerkleBranch) Serialize() string {
-	return am.numberOfBranches + am.mask
+	items := ""
+	for _, item := range am.items {
+		items = items + item
+	}
+	return varUint(uint(len(am.items))) + items + hex.EncodeToString(binary.LittleEndian.AppendUint32(nil, am.index))
 }
 
 func debugAuxPow(parentBlock BitcoinBlock, parentMerkle ParentMerkleBranch, auxchainMerkle AuxMerkleBranch) {
@@ -0,0 +1,182 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const (
+	dogecoinAuxHash = "a0c4f6a2cb8be8f4be5fbaf0c0f38dba1a3dbbd49fcc4fbe66e6a8f5d5e9e1c4"
+	namecoinAuxHash = "00000000000000000a5ba6b7a4c7e6cc5b9a9fe36f9ed7d4e9de5be4f2d6a7b1"
+	pepecoinAuxHash = "3f6b1cbc58a0ad2b6b8aa2b8e8b4a0d2f4ae3a6c3a8c2d1b0f9e8d7c6b5a4938"
+)
+
+// The same sha256d as the rest of the package, kept separate so the check doesn't lean on the code under test
+func testDoubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// Namecoin's CheckMerkleBranch, hashes in their internal byte order
+func checkMerkleBranch(hash []byte, branch [][]byte, index uint32) []byte {
+	for _, item := range branch {
+		if index&1 == 1 {
+			hash = testDoubleSha256(append(append([]byte{}, item...), hash...))
+		} else {
+			hash = testDoubleSha256(append(append([]byte{}, hash...), item...))
+		}
+		index >>= 1
+	}
+	return hash
+}
+
+// Reads back what AuxMerkleBranch.Serialize writes into the auxpow: count, hashes and index
+func parseAuxMerkleBranch(t *testing.T, serialized string) ([][]byte, uint32) {
+	t.Helper()
+	raw, err := hex.DecodeString(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) < 5 || raw[0] >= 0xfd {
+		t.Fatalf("unexpected branch %v", serialized)
+	}
+	count := int(raw[0])
+	if len(raw) != 1+count*32+4 {
+		t.Fatalf("branch of %v hashes is %v bytes", count, len(raw))
+	}
+	var items [][]byte
+	for i := 0; i < count; i++ {
+		items = append(items, raw[1+i*32:1+(i+1)*32])
+	}
+	return items, binary.LittleEndian.Uint32(raw[1+count*32:])
+}
+
+// One chain is a tree of one, its commitment is what a single aux block always got
+func TestSingleChainAuxCommitment(t *testing.T) {
+	tree, err := MakeAuxMerkleTree([]AuxBlock{{Hash: dogecoinAuxHash, ChainID: 98}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The old trailer had 4 more bytes after size and nonce, nothing reads past the nonce
+	old := mergedMiningHeader + dogecoinAuxHash + "010000000000000000002632"
+	if commitment := tree.Commitment(); commitment != old[:len(old)-8] {
+		t.Fatalf("commitment %v, expected %v", commitment, old[:len(old)-8])
+	}
+
+	branch := tree.branch(0)
+	if serialized := branch.Serialize(); serialized != "0000000000" {
+		t.Fatalf("branch %v, expected no hashes at index 0", serialized)
+	}
+}
+
+func TestAuxMerkleTree(t *testing.T) {
+	tests := []struct {
+		name      string
+		auxBlocks []AuxBlock
+		size      uint32
+	}{
+		{
+			name:      "separate slots",
+			auxBlocks: []AuxBlock{{Hash: dogecoinAuxHash, ChainID: 98}, {Hash: namecoinAuxHash, ChainID: 1}},
+			size:      2,
+		},
+		{
+			name:      "collision at 2 slots",
+			auxBlocks: []AuxBlock{{Hash: dogecoinAuxHash, ChainID: 98}, {Hash: namecoinAuxHash, ChainID: 16}},
+			size:      4,
+		},
+		{
+			name:      "collision at 4 slots",
+			auxBlocks: []AuxBlock{{Hash: dogecoinAuxHash, ChainID: 98}, {Hash: namecoinAuxHash, ChainID: 102}},
+			size:      8,
+		},
+		{
+			name: "three chains",
+			auxBlocks: []AuxBlock{
+				{Hash: dogecoinAuxHash, ChainID: 98},
+				{Hash: namecoinAuxHash, ChainID: 1},
+				{Hash: pepecoinAuxHash, ChainID: 63},
+			},
+			size: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, err := MakeAuxMerkleTree(test.auxBlocks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tree.Size != test.size {
+				t.Fatalf("tree of %v slots, expected %v", tree.Size, test.size)
+			}
+
+			// Two chains' slots differ by their chain IDs times an odd number, modulo the size.
+			// So every nonce collides the same way and only a bigger tree separates them
+			if smaller := tree.Size / 2; smaller >= uint32(len(test.auxBlocks)) {
+				for nonce := uint32(0); nonce < auxMerkleNonceTrials; nonce++ {
+					if _, unique := auxMerkleSlots(test.auxBlocks, nonce, smaller); unique {
+						t.Fatalf("nonce %v fits %v slots", nonce, smaller)
+					}
+				}
+			}
+
+			commitment := tree.Commitment()
+			if !strings.HasPrefix(commitment, mergedMiningHeader) || len(commitment) != 2*(4+32+4+4) {
+				t.Fatalf("malformed commitment %v", commitment)
+			}
+			rootBytes, _ := hex.DecodeString(commitment[8:72])
+			root := reverse(rootBytes) // Coinbases hold the root reversed
+			sizeAndNonce, _ := hex.DecodeString(commitment[72:])
+			if binary.LittleEndian.Uint32(sizeAndNonce) != tree.Size || binary.LittleEndian.Uint32(sizeAndNonce[4:]) != tree.Nonce {
+				t.Fatalf("commitment size and nonce %x, expected %v and %v", sizeAndNonce, tree.Size, tree.Nonce)
+			}
+
+			taken := make(map[uint32]bool)
+			for i, auxBlock := range test.auxBlocks {
+				branch := tree.branch(i)
+				items, index := parseAuxMerkleBranch(t, branch.Serialize())
+
+				// What the aux chain checks: its expected slot, the size from the branch length, then the root
+				if expected := auxMerkleSlot(tree.Nonce, auxBlock.ChainID, tree.Size); index != expected {
+					t.Errorf("chain %v at index %v, its expected index is %v", auxBlock.ChainID, index, expected)
+				}
+				if uint32(1)<<len(items) != tree.Size {
+					t.Errorf("chain %v branch of %v hashes for %v slots", auxBlock.ChainID, len(items), tree.Size)
+				}
+				if taken[index] {
+					t.Errorf("chain %v shares slot %v", auxBlock.ChainID, index)
+				}
+				taken[index] = true
+
+				hash, _ := hex.DecodeString(auxBlock.Hash)
+				if rebuilt := checkMerkleBranch(reverse(hash), items, index); !bytes.Equal(rebuilt, root) {
+					t.Errorf("chain %v branch rebuilds %x, committed root is %x", auxBlock.ChainID, rebuilt, root)
+				}
+			}
+		})
+	}
+}
+
+func TestAuxMerkleTreeErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		auxBlocks []AuxBlock
+	}{
+		{name: "same chain ID", auxBlocks: []AuxBlock{{Hash: dogecoinAuxHash, ChainID: 98}, {Hash: namecoinAuxHash, ChainID: 98}}},
+		{name: "short hash", auxBlocks: []AuxBlock{{Hash: dogecoinAuxHash[2:], ChainID: 98}}},
+		{name: "not hex", auxBlocks: []AuxBlock{{Hash: "zz" + dogecoinAuxHash[2:], ChainID: 98}}},
+	}
+
+	for _, test := range tests {
+		if _, err := MakeAuxMerkleTree(test.auxBlocks); err == nil {
+			t.Errorf("%v: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package bitcoin
+
+type BitcoinCash struct{}
+
+func init() {
+	RegisterChain(BitcoinCash{})
+}
+
+func (BitcoinCash) ChainName() string {
+	return "bitcoincash"
+}
+
+func (BitcoinCash) CoinbaseDigest(coinbase string) (string, error) {
+	return DoubleSha256(coinbase)
+}
+
+func (BitcoinCash) HeaderDigest(header string) (string, error) {
+	return DoubleSha256(header)
+}
+
+func (BitcoinCash) HeaderAlgorithm() string {
+	return "sha256d"
+}
+
+func (BitcoinCash) ShareMultiplier() float64 {
+	return 1
+}
+
+// No segwit, cashaddr or the legacy base58 addresses it forked with
+var bitcoinCashAddressFormats = map[string]AddressFormat{
+	"main":    {PubKeyHash: 0x00, ScriptHash: []byte{0x05}, CashAddr: "bitcoincash"},
+	"test":    {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}, CashAddr: "bchtest"},
+	"regtest": {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}, CashAddr: "bchreg"},
+}
+
+func (BitcoinCash) AddressFormat(network string) (AddressFormat, error) {
+	format, exists := bitcoinCashAddressFormats[network]
+	if !exists {
+		return format, errUnknownNetwork
+	}
+	return format, nil
+}
+
+func (BitcoinCash) MinimumConfirmations() uint {
+	return uint(BitcoinMinConfirmations)
+}
+
+func (BitcoinCash) BlockTemplateRules() []string {
+	return nil
+}
+
+func (BitcoinCash) AuxChainID() int {
+	return 0
+}
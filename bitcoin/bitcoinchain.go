@@ -0,0 +1,56 @@
+package bitcoin
+
+// Bitcoin itself, the type BitcoinBlock is named after
+type Bitcoin struct{}
+
+func init() {
+	RegisterChain(Bitcoin{})
+}
+
+func (Bitcoin) ChainName() string {
+	return "bitcoin"
+}
+
+func (Bitcoin) CoinbaseDigest(coinbase string) (string, error) {
+	return DoubleSha256(coinbase)
+}
+
+func (Bitcoin) HeaderDigest(header string) (string, error) {
+	return DoubleSha256(header)
+}
+
+func (Bitcoin) HeaderAlgorithm() string {
+	return "sha256d"
+}
+
+func (Bitcoin) ShareMultiplier() float64 {
+	return 1
+}
+
+var bitcoinAddressFormats = map[string]AddressFormat{
+	"main":    {PubKeyHash: 0x00, ScriptHash: []byte{0x05}, Bech32HRP: "bc"},
+	"test":    {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}, Bech32HRP: "tb"},
+	"signet":  {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}, Bech32HRP: "tb"},
+	"regtest": {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}, Bech32HRP: "bcrt"},
+}
+
+func (Bitcoin) AddressFormat(network string) (AddressFormat, error) {
+	format, exists := bitcoinAddressFormats[network]
+	if !exists {
+		return format, errUnknownNetwork
+	}
+	return format, nil
+}
+
+func (Bitcoin) MinimumConfirmations() uint {
+	return uint(BitcoinMinConfirmations)
+}
+
+// getblocktemplate refuses to answer without segwit
+func (Bitcoin) BlockTemplateRules() []string {
+	return []string{"segwit"}
+}
+
+func (Bitcoin) AuxChainID() int {
+	return 0
+}
@@ -1,25 +1,147 @@
 package bitcoin
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
 const BitcoinMinConfirmations = 102
 
 type Blockchain interface {
 	ChainName() string
 	CoinbaseDigest(coinbase string) (string, error)
 	HeaderDigest(header string) (string, error)
+	HeaderAlgorithm() string // A key of algorithms, I.e. "scrypt"
 	ShareMultiplier() float64
 	MinimumConfirmations() uint
+	AddressFormat(network string) (AddressFormat, error)
+	BlockTemplateRules() []string // Sent as getblocktemplate's rules when this is the primary chain
+	AuxChainID() int              // Used when createauxblock doesn't say, 0 for chains that aren't merge mined
+}
+
+var chains = struct {
+	sync.RWMutex
+	registered map[string]Blockchain
+}{registered: make(map[string]Blockchain)}
 
-	ValidMainnetAddress(address string) bool
-	ValidTestnetAddress(address string) bool
+// Chains register themselves from init(), or from config with DescribeChain
+func RegisterChain(chain Blockchain) {
+	chains.Lock()
+	defer chains.Unlock()
+
+	if _, exists := chains.registered[chain.ChainName()]; exists {
+		panic("Blockchain registered twice: " + chain.ChainName())
+	}
+	chains.registered[chain.ChainName()] = chain
+}
+
+func LookupChain(chainName string) (Blockchain, bool) {
+	chains.RLock()
+	defer chains.RUnlock()
+
+	chain, exists := chains.registered[chainName]
+	return chain, exists
 }
 
 func GetChain(chainName string) Blockchain {
-	switch chainName {
-	case "dogecoin":
-		return Dogecoin{}
-	case "litecoin":
-		return Litecoin{}
-	default:
+	chain, exists := LookupChain(chainName)
+	if !exists {
 		panic("Unknown blockchain: " + chainName)
 	}
+	return chain
+}
+
+// Everything needed to mine a Bitcoin family coin without writing a Blockchain for it
+type ChainDescription struct {
+	Name                 string
+	HeaderAlgorithm      string  // A key of algorithms, I.e. "scrypt"
+	CoinbaseAlgorithm    string  // Defaults to "sha256d"
+	ShareMultiplier      float64 // Defaults to the header algorithm's
+	MinimumConfirmations uint
+	AddressFormats       map[string]AddressFormat // network => format
+	BlockTemplateRules   []string
+	AuxChainID           int
+}
+
+type describedChain struct {
+	description    ChainDescription
+	headerDigest   func(string) (string, error)
+	coinbaseDigest func(string) (string, error)
+}
+
+func DescribeChain(description ChainDescription) (Blockchain, error) {
+	if description.Name == "" {
+		return nil, errors.New("chain description needs a name")
+	}
+	if description.CoinbaseAlgorithm == "" {
+		description.CoinbaseAlgorithm = "sha256d"
+	}
+	if description.MinimumConfirmations == 0 {
+		description.MinimumConfirmations = BitcoinMinConfirmations
+	}
+	if len(description.AddressFormats) == 0 {
+		return nil, fmt.Errorf("%v: no address formats", description.Name)
+	}
+
+	header, exists := GetAlgorithm(description.HeaderAlgorithm)
+	if !exists {
+		return nil, fmt.Errorf("%v: unknown header algorithm %q", description.Name, description.HeaderAlgorithm)
+	}
+	coinbase, exists := GetAlgorithm(description.CoinbaseAlgorithm)
+	if !exists {
+		return nil, fmt.Errorf("%v: unknown coinbase algorithm %q", description.Name, description.CoinbaseAlgorithm)
+	}
+	if description.ShareMultiplier == 0 {
+		description.ShareMultiplier = header.ShareMultiplier
+	}
+	if description.ShareMultiplier < 0 {
+		return nil, fmt.Errorf("%v: share multiplier must be positive", description.Name)
+	}
+
+	return describedChain{
+		description:    description,
+		headerDigest:   header.Digest,
+		coinbaseDigest: coinbase.Digest,
+	}, nil
+}
+
+func (c describedChain) ChainName() string {
+	return c.description.Name
+}
+
+func (c describedChain) CoinbaseDigest(coinbase string) (string, error) {
+	return c.coinbaseDigest(coinbase)
+}
+
+func (c describedChain) HeaderDigest(header string) (string, error) {
+	return c.headerDigest(header)
+}
+
+func (c describedChain) HeaderAlgorithm() string {
+	return c.description.HeaderAlgorithm
+}
+
+func (c describedChain) ShareMultiplier() float64 {
+	return c.description.ShareMultiplier
+}
+
+func (c describedChain) MinimumConfirmations() uint {
+	return c.description.MinimumConfirmations
+}
+
+func (c describedChain) AddressFormat(network string) (AddressFormat, error) {
+	format, exists := c.description.AddressFormats[network]
+	if !exists {
+		return format, errUnknownNetwork
+	}
+	return format, nil
+}
+
+func (c describedChain) BlockTemplateRules() []string {
+	return c.description.BlockTemplateRules
+}
+
+func (c describedChain) AuxChainID() int {
+	return c.description.AuxChainID
 }
@@ -1,11 +1,11 @@
 package bitcoin
 
-import (
-	"regexp"
-)
-
 type Dogecoin struct{}
 
+func init() {
+	RegisterChain(Dogecoin{})
+}
+
 func (Dogecoin) ChainName() string {
 	return "dogecoin"
 }
@@ -18,19 +18,37 @@ func (Dogecoin) HeaderDigest(header string) (string, error) {
 	return ScryptDigest(header)
 }
 
+func (Dogecoin) HeaderAlgorithm() string {
+	return "scrypt"
+}
+
 func (Dogecoin) ShareMultiplier() float64 {
 	return 65536
 }
 
-func (Dogecoin) ValidMainnetAddress(address string) bool {
-	// Apparently a base58 decode is the best way to validate.. TODO.
-	return regexp.MustCompile("^(D|A|9)[a-km-zA-HJ-NP-Z1-9]{33,34}$").MatchString(address)
+var dogecoinAddressFormats = map[string]AddressFormat{
+	"main":    {PubKeyHash: 0x1e, ScriptHash: []byte{0x16}},
+	"test":    {PubKeyHash: 0x71, ScriptHash: []byte{0xc4}},
+	"regtest": {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}},
 }
 
-func (Dogecoin) ValidTestnetAddress(address string) bool {
-	return regexp.MustCompile("^(n|2)[a-km-zA-HJ-NP-Z1-9]{33}$").MatchString(address)
+// No segwit on Dogecoin
+func (Dogecoin) AddressFormat(network string) (AddressFormat, error) {
+	format, exists := dogecoinAddressFormats[network]
+	if !exists {
+		return format, errUnknownNetwork
+	}
+	return format, nil
 }
 
 func (Dogecoin) MinimumConfirmations() uint {
 	return uint(251)
 }
+
+func (Dogecoin) BlockTemplateRules() []string {
+	return nil
+}
+
+func (Dogecoin) AuxChainID() int {
+	return 0x62
+}
@@ -8,7 +8,7 @@ import (
 )
 
 type BlockGenerator interface {
-	MakeHeader(extranonce, nonce string) (string, error) // On aux generation, on work verfication, and possibily even work submission
+	MakeHeader(extranonce, nonce, nonceTime string, versionBits, versionMask uint32) (string, error) // On aux generation, on work verfication, and possibily even work submission
 	Header() string
 	Sum() (*big.Int, error)  // On work verification, many, more than than header generation
 	Submit() (string, error) // On submission
@@ -16,7 +16,7 @@ type BlockGenerator interface {
 
 var jobCounter int
 
-func GenerateWork(template *Template, auxBlock *AuxBlock, chainName, arbitrary, poolPayoutPubScriptKey string, reservedArbitraryByteLength int) (*BitcoinBlock, Work, error) { // On trigger
+func GenerateWork(template *Template, chainName, arbitrary, poolPayoutPubScriptKey string, reservedArbitraryByteLength int) (*BitcoinBlock, Work, error) { // On trigger
 	if template == nil {
 		return nil, nil, errors.New("Template cannot be null")
 	}
@@ -59,19 +59,14 @@ func GenerateWork(template *Template, auxBlock *AuxBlock, chainName, arbitrary,
 	return &block, work, nil
 }
 
-func (b *BitcoinBlock) MakeHeader(extranonce, nonce, nonceTime string) (string, error) {
+// versionBits are the BIP310 rolled bits, only those inside versionMask replace the template's version
+func (b *BitcoinBlock) MakeHeader(extranonce, nonce, nonceTime string, versionBits, versionMask uint32) (string, error) {
 	if b.Template == nil {
 		return "", errors.New("generate work first")
 	}
 
 	var err error
-	coinbase := Coinbase{
-		CoinbaseInital: b.coinbaseInitial,
-		Arbitrary:      extranonce,
-		CoinbaseFinal:  b.coinbaseFinal,
-	}
-
-	b.coinbase = coinbase.Serialize()
+	b.coinbase = b.coinbaseWith(extranonce)
 	coinbaseHashed, err := b.CoinbaseHashed()
 	if err != nil {
 		return "", err
@@ -84,7 +79,9 @@ func (b *BitcoinBlock) MakeHeader(extranonce, nonce, nonceTime string) (string,
 
 	t := b.Template
 
-	b.header, err = blockHeader(uint(t.Version), t.PrevBlockHash, merkleRoot, nonceTime, t.Bits, nonce)
+	version := (uint32(t.Version) &^ versionMask) | (versionBits & versionMask)
+
+	b.header, err = blockHeader(uint(version), t.PrevBlockHash, merkleRoot, nonceTime, t.Bits, nonce)
 
 	if err != nil {
 		return "", err
@@ -93,6 +90,29 @@ func (b *BitcoinBlock) MakeHeader(extranonce, nonce, nonceTime string) (string,
 	return b.header, nil
 }
 
+// In header byte order, for miners that only roll the header (Stratum V2 standard channels)
+func (b *BitcoinBlock) MerkleRoot(extranonce string) (string, error) {
+	if b.Template == nil {
+		return "", errors.New("generate work first")
+	}
+
+	coinbaseHashed, err := b.chain.CoinbaseDigest(b.coinbaseWith(extranonce))
+	if err != nil {
+		return "", err
+	}
+
+	return makeHeaderMerkleRoot(coinbaseHashed, b.merkleSteps)
+}
+
+func (b *BitcoinBlock) coinbaseWith(extranonce string) string {
+	coinbase := Coinbase{
+		CoinbaseInital: b.coinbaseInitial,
+		Arbitrary:      extranonce,
+		CoinbaseFinal:  b.coinbaseFinal,
+	}
+	return coinbase.Serialize()
+}
+
 func (b *BitcoinBlock) HeaderHashed() (string, error) {
 	// TODO - break out headerdigest vs blockdigest
 	header, err := b.chain.CoinbaseDigest(b.header)
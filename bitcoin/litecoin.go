@@ -1,11 +1,11 @@
 package bitcoin
 
-import (
-	"regexp"
-)
-
 type Litecoin struct{}
 
+func init() {
+	RegisterChain(Litecoin{})
+}
+
 func (Litecoin) ChainName() string {
 	return "litecoin"
 }
@@ -18,18 +18,38 @@ func (Litecoin) HeaderDigest(header string) (string, error) {
 	return ScryptDigest(header)
 }
 
+func (Litecoin) HeaderAlgorithm() string {
+	return "scrypt"
+}
+
 func (Litecoin) ShareMultiplier() float64 {
 	return 65536
 }
 
-func (Litecoin) ValidMainnetAddress(address string) bool {
-	return regexp.MustCompile("^(L|M)[A-Za-z0-9]{33}$|^(ltc1)[0-9A-Za-z]{39}$").MatchString(address)
+// 0x05 and 0xc4 are the P2SH versions Litecoin shared with Bitcoin before M and Q addresses
+var litecoinAddressFormats = map[string]AddressFormat{
+	"main":    {PubKeyHash: 0x30, ScriptHash: []byte{0x32, 0x05}, Bech32HRP: "ltc"},
+	"test":    {PubKeyHash: 0x6f, ScriptHash: []byte{0x3a, 0xc4}, Bech32HRP: "tltc"},
+	"regtest": {PubKeyHash: 0x6f, ScriptHash: []byte{0x3a, 0xc4}, Bech32HRP: "rltc"},
 }
 
-func (Litecoin) ValidTestnetAddress(address string) bool {
-	return regexp.MustCompile("[a-z0-9]{44}").MatchString(address)
+func (Litecoin) AddressFormat(network string) (AddressFormat, error) {
+	format, exists := litecoinAddressFormats[network]
+	if !exists {
+		return format, errUnknownNetwork
+	}
+	return format, nil
 }
 
 func (Litecoin) MinimumConfirmations() uint {
 	return uint(BitcoinMinConfirmations)
 }
+
+func (Litecoin) BlockTemplateRules() []string {
+	return []string{"mweb", "segwit"}
+}
+
+// Litecoin is only ever the parent chain
+func (Litecoin) AuxChainID() int {
+	return 0
+}
@@ -0,0 +1,54 @@
+package bitcoin
+
+// Merge mined under a SHA-256d parent like Bitcoin
+type Namecoin struct{}
+
+func init() {
+	RegisterChain(Namecoin{})
+}
+
+func (Namecoin) ChainName() string {
+	return "namecoin"
+}
+
+func (Namecoin) CoinbaseDigest(coinbase string) (string, error) {
+	return DoubleSha256(coinbase)
+}
+
+func (Namecoin) HeaderDigest(header string) (string, error) {
+	return DoubleSha256(header)
+}
+
+func (Namecoin) HeaderAlgorithm() string {
+	return "sha256d"
+}
+
+func (Namecoin) ShareMultiplier() float64 {
+	return 1
+}
+
+var namecoinAddressFormats = map[string]AddressFormat{
+	"main":    {PubKeyHash: 0x34, ScriptHash: []byte{0x0d}, Bech32HRP: "nc"},
+	"test":    {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}, Bech32HRP: "tn"},
+	"regtest": {PubKeyHash: 0x6f, ScriptHash: []byte{0xc4}, Bech32HRP: "ncrt"},
+}
+
+func (Namecoin) AddressFormat(network string) (AddressFormat, error) {
+	format, exists := namecoinAddressFormats[network]
+	if !exists {
+		return format, errUnknownNetwork
+	}
+	return format, nil
+}
+
+func (Namecoin) MinimumConfirmations() uint {
+	return uint(BitcoinMinConfirmations)
+}
+
+func (Namecoin) BlockTemplateRules() []string {
+	return []string{"segwit"}
+}
+
+func (Namecoin) AuxChainID() int {
+	return 1
+}
@@ -0,0 +1,319 @@
+package bitcoin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// BIP340 signatures come from btcec, BIP324 ElligatorSwift is built on decred's constant time field.
+// Decred's scalar multiplication isn't constant time, so ECDH with a secret key is blinded, see blindedScalarMult
+
+// ElligatorSwift needs this exact root, the one SquareRootVal returns
+var minus3Sqrt, _ = fieldSqrt(fieldNeg(new(secp256k1.FieldVal).SetInt(3)))
+
+// Field helpers take and return normalized values, so callers never track magnitudes
+func fieldAdd(a, b *secp256k1.FieldVal) *secp256k1.FieldVal {
+	return new(secp256k1.FieldVal).Add2(a, b).Normalize()
+}
+
+func fieldNeg(a *secp256k1.FieldVal) *secp256k1.FieldVal {
+	return new(secp256k1.FieldVal).NegateVal(a, 1).Normalize()
+}
+
+func fieldSub(a, b *secp256k1.FieldVal) *secp256k1.FieldVal {
+	return fieldAdd(a, fieldNeg(b))
+}
+
+func fieldMul(a, b *secp256k1.FieldVal) *secp256k1.FieldVal {
+	return new(secp256k1.FieldVal).Mul2(a, b).Normalize()
+}
+
+// Dividing by zero gives zero
+func fieldDiv(a, b *secp256k1.FieldVal) *secp256k1.FieldVal {
+	return fieldMul(a, new(secp256k1.FieldVal).Set(b).Inverse())
+}
+
+func fieldInt(n uint16) *secp256k1.FieldVal {
+	return new(secp256k1.FieldVal).SetInt(n)
+}
+
+func fieldSqrt(a *secp256k1.FieldVal) (*secp256k1.FieldVal, bool) {
+	root := new(secp256k1.FieldVal)
+	exists := root.SquareRootVal(a)
+	return root.Normalize(), exists
+}
+
+// Reduced mod p like BIP324's decoding expects
+func fieldFromBytes(b []byte) *secp256k1.FieldVal {
+	element := new(secp256k1.FieldVal)
+	element.SetByteSlice(b)
+	return element.Normalize()
+}
+
+func curveY2(x *secp256k1.FieldVal) *secp256k1.FieldVal {
+	return fieldAdd(fieldMul(fieldMul(x, x), x), fieldInt(7))
+}
+
+func isValidX(x *secp256k1.FieldVal) bool {
+	_, valid := fieldSqrt(curveY2(x))
+	return valid
+}
+
+func secretKeyScalar(secretKey []byte) (*secp256k1.ModNScalar, error) {
+	d := new(secp256k1.ModNScalar)
+	if len(secretKey) != 32 || d.SetByteSlice(secretKey) || d.IsZero() {
+		return nil, errors.New("invalid secp256k1 secret key")
+	}
+	return d, nil
+}
+
+func NewSecretKey(random io.Reader) ([]byte, error) {
+	secretKey := make([]byte, 32)
+	for {
+		_, err := io.ReadFull(random, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = secretKeyScalar(secretKey); err == nil {
+			return secretKey, nil
+		}
+	}
+}
+
+func privateKey(secretKey []byte) (*secp256k1.PrivateKey, error) {
+	d, err := secretKeyScalar(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1.NewPrivateKey(d), nil
+}
+
+// BIP340 public key
+func XOnlyPublicKey(secretKey []byte) ([]byte, error) {
+	key, err := privateKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return schnorr.SerializePubKey(key.PubKey()), nil
+}
+
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	hash := sha256.New()
+	hash.Write(tagHash[:])
+	hash.Write(tagHash[:])
+	for _, d := range data {
+		hash.Write(d)
+	}
+	return hash.Sum(nil)
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0340.mediawiki#default-signing
+// Messages are 32 byte digests
+func SchnorrSign(secretKey, message, auxRandom []byte) ([]byte, error) {
+	if len(auxRandom) != 32 {
+		return nil, errors.New("schnorr auxiliary randomness must be 32 bytes")
+	}
+	key, err := privateKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var aux [32]byte
+	copy(aux[:], auxRandom)
+	signature, err := schnorr.Sign(key, message, schnorr.CustomNonce(aux))
+	if err != nil {
+		return nil, err
+	}
+	return signature.Serialize(), nil
+}
+
+func SchnorrVerify(publicKey, message, signature []byte) bool {
+	public, err := schnorr.ParsePubKey(publicKey)
+	if err != nil {
+		return false
+	}
+	parsed, err := schnorr.ParseSignature(signature)
+	if err != nil {
+		return false
+	}
+	return parsed.Verify(message, public)
+}
+
+// Multiplies by two random shares of k instead of k itself, so how long either takes says nothing about k.
+// Fresh shares every call, a static key is never multiplied the same way twice
+func blindedScalarMult(k *secp256k1.ModNScalar, point *secp256k1.JacobianPoint) (*secp256k1.JacobianPoint, error) {
+	blindBytes, err := NewSecretKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	blind, err := secretKeyScalar(blindBytes)
+	if err != nil {
+		return nil, err
+	}
+	rest := new(secp256k1.ModNScalar).NegateVal(blind).Add(k)
+
+	var first, second, result secp256k1.JacobianPoint
+	secp256k1.ScalarMultNonConst(blind, point, &first)
+	secp256k1.ScalarMultNonConst(rest, point, &second)
+	secp256k1.AddNonConst(&first, &second, &result)
+	return &result, nil
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0324.mediawiki#elligatorswift-encoding-of-curve-x-coordinates
+func xSwiftEC(u, t *secp256k1.FieldVal) *secp256k1.FieldVal {
+	if u.IsZero() {
+		u = fieldInt(1)
+	}
+	if t.IsZero() {
+		t = fieldInt(1)
+	}
+	u3Plus7 := curveY2(u)
+	if fieldAdd(u3Plus7, fieldMul(t, t)).IsZero() {
+		t = fieldAdd(t, t)
+	}
+
+	x := fieldDiv(fieldSub(u3Plus7, fieldMul(t, t)), fieldAdd(t, t))
+	y := fieldDiv(fieldAdd(x, t), fieldMul(minus3Sqrt, u))
+
+	two := fieldInt(2)
+	candidates := []*secp256k1.FieldVal{
+		fieldAdd(u, fieldMul(fieldInt(4), fieldMul(y, y))),
+		fieldDiv(fieldSub(fieldNeg(fieldDiv(x, y)), u), two),
+		fieldDiv(fieldSub(fieldDiv(x, y), u), two),
+	}
+	for _, candidate := range candidates {
+		if isValidX(candidate) {
+			return candidate
+		}
+	}
+
+	panic("xSwiftEC: no valid x, impossible for secp256k1")
+}
+
+// One of the eight preimage branches, nil when this branch has no t for x
+func xSwiftECInverse(x, u *secp256k1.FieldVal, branch int) *secp256k1.FieldVal {
+	var v, s *secp256k1.FieldVal
+	u3Plus7 := curveY2(u)
+	if branch&2 == 0 {
+		if isValidX(fieldSub(fieldNeg(x), u)) {
+			return nil
+		}
+		v = x
+		denominator := fieldAdd(fieldAdd(fieldMul(u, u), fieldMul(u, v)), fieldMul(v, v))
+		if denominator.IsZero() {
+			return nil
+		}
+		s = fieldDiv(fieldNeg(u3Plus7), denominator)
+	} else {
+		s = fieldSub(x, u)
+		if s.IsZero() {
+			return nil
+		}
+		inner := fieldAdd(fieldMul(fieldInt(4), u3Plus7), fieldMul(fieldInt(3), fieldMul(s, fieldMul(u, u))))
+		r, exists := fieldSqrt(fieldMul(fieldNeg(s), inner))
+		if !exists {
+			return nil
+		}
+		if branch&1 == 1 && r.IsZero() {
+			return nil
+		}
+		v = fieldDiv(fieldSub(fieldDiv(r, s), u), fieldInt(2))
+	}
+
+	w, exists := fieldSqrt(s)
+	if !exists {
+		return nil
+	}
+
+	two := fieldInt(2)
+	onePlus := fieldDiv(fieldMul(u, fieldAdd(fieldInt(1), minus3Sqrt)), two)
+	oneMinus := fieldDiv(fieldMul(u, fieldSub(fieldInt(1), minus3Sqrt)), two)
+	switch branch & 5 {
+	case 0:
+		return fieldNeg(fieldMul(w, fieldAdd(oneMinus, v)))
+	case 1:
+		return fieldMul(w, fieldAdd(onePlus, v))
+	case 4:
+		return fieldMul(w, fieldAdd(oneMinus, v))
+	default:
+		return fieldNeg(fieldMul(w, fieldAdd(onePlus, v)))
+	}
+}
+
+// 64 bytes indistinguishable from random that decode to the secret key's public x
+func EllSwiftCreate(secretKey []byte, random io.Reader) ([]byte, error) {
+	key, err := privateKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	x := fieldFromBytes(schnorr.SerializePubKey(key.PubKey()))
+
+	entropy := make([]byte, 33)
+	for {
+		_, err = io.ReadFull(random, entropy)
+		if err != nil {
+			return nil, err
+		}
+		u := fieldFromBytes(entropy[:32])
+		if u.IsZero() {
+			continue
+		}
+
+		t := xSwiftECInverse(x, u, int(entropy[32]&7))
+		if t == nil || !xSwiftEC(u, t).Equals(x) {
+			continue
+		}
+
+		return append(u.Bytes()[:], t.Bytes()[:]...), nil
+	}
+}
+
+// The 32 byte x an encoding stands for
+func EllSwiftDecode(encoded []byte) ([]byte, error) {
+	if len(encoded) != 64 {
+		return nil, errors.New("ellswift encodings are 64 bytes")
+	}
+	x := xSwiftEC(fieldFromBytes(encoded[:32]), fieldFromBytes(encoded[32:]))
+	return x.Bytes()[:], nil
+}
+
+// BIP324 x-only ECDH, A is the initiator's encoding and B the responder's
+func EllSwiftXDH(encodingA, encodingB, secretKey []byte, initiator bool) ([]byte, error) {
+	d, err := secretKeyScalar(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	theirs := encodingB
+	if !initiator {
+		theirs = encodingA
+	}
+	theirX, err := EllSwiftDecode(theirs)
+	if err != nil {
+		return nil, err
+	}
+	x := fieldFromBytes(theirX)
+	var y secp256k1.FieldVal
+	if !secp256k1.DecompressY(x, false, &y) {
+		return nil, errors.New("x is not on secp256k1")
+	}
+	point := secp256k1.MakeJacobianPoint(x, &y, fieldInt(1))
+
+	shared, err := blindedScalarMult(d, &point)
+	if err != nil {
+		return nil, err
+	}
+	// Infinity has z = 0, which comes out of ToAffine as (0, 0)
+	shared.ToAffine()
+	if shared.X.IsZero() && shared.Y.IsZero() {
+		return nil, errors.New("ecdh produced the point at infinity")
+	}
+
+	return taggedHash("bip324_ellswift_xonly_ecdh", encodingA, encodingB, shared.X.Bytes()[:]), nil
+}
@@ -0,0 +1,158 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+// Vectors are copied unchanged from github.com/bitcoin/bips, bip324_xdh.csv is the key exchange columns of
+// bip-0324/packet_encoding_test_vectors.csv
+func readVectors(t *testing.T, name string) []map[string]string {
+	t.Helper()
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestSchnorrVectors(t *testing.T) {
+	for _, row := range readVectors(t, "bip340_vectors.csv") {
+		message := mustHex(t, row["message"])
+		if len(message) != 32 {
+			continue // Only 32 byte digests are signed here, BIP340 allows any length
+		}
+		publicKey := mustHex(t, row["public key"])
+		signature := mustHex(t, row["signature"])
+
+		if row["secret key"] != "" {
+			secretKey := mustHex(t, row["secret key"])
+			public, err := XOnlyPublicKey(secretKey)
+			if err != nil || !bytes.Equal(public, publicKey) {
+				t.Errorf("vector %v: public key %x, %v", row["index"], public, err)
+			}
+			signed, err := SchnorrSign(secretKey, message, mustHex(t, row["aux_rand"]))
+			if err != nil || !bytes.Equal(signed, signature) {
+				t.Errorf("vector %v: signature %x, %v", row["index"], signed, err)
+			}
+		}
+
+		expected := row["verification result"] == "TRUE"
+		if SchnorrVerify(publicKey, message, signature) != expected {
+			t.Errorf("vector %v: verify should be %v, %v", row["index"], expected, row["comment"])
+		}
+	}
+}
+
+func TestEllSwiftDecodeVectors(t *testing.T) {
+	for _, row := range readVectors(t, "bip324_ellswift_decode.csv") {
+		x, err := EllSwiftDecode(mustHex(t, row["ellswift"]))
+		if err != nil || hex.EncodeToString(x) != row["x"] {
+			t.Errorf("%v: decoded %x, %v", row["comment"], x, err)
+		}
+	}
+}
+
+func TestXSwiftECInverseVectors(t *testing.T) {
+	for _, row := range readVectors(t, "bip324_xswiftec_inv.csv") {
+		u := fieldFromBytes(mustHex(t, row["u"]))
+		x := fieldFromBytes(mustHex(t, row["x"]))
+		for branch, column := range []string{"case0_t", "case1_t", "case2_t", "case3_t", "case4_t", "case5_t", "case6_t", "case7_t"} {
+			inverse := xSwiftECInverse(x, u, branch)
+			if row[column] == "" {
+				if inverse != nil {
+					t.Errorf("%v %v: expected no preimage, got %x", row["comment"], column, inverse.Bytes())
+				}
+				continue
+			}
+			if inverse == nil {
+				t.Errorf("%v %v: expected %v, got none", row["comment"], column, row[column])
+				continue
+			}
+			if hex.EncodeToString(inverse.Bytes()[:]) != row[column] {
+				t.Errorf("%v %v: expected %v, got %x", row["comment"], column, row[column], inverse.Bytes())
+			}
+			if !xSwiftEC(u, inverse).Equals(x) {
+				t.Errorf("%v %v: preimage doesn't decode to x", row["comment"], column)
+			}
+		}
+	}
+}
+
+func TestEllSwiftCreateRoundTrip(t *testing.T) {
+	for i := 0; i < 16; i++ {
+		secretKey, err := NewSecretKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := EllSwiftCreate(secretKey, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := EllSwiftDecode(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		public, _ := XOnlyPublicKey(secretKey)
+		if !bytes.Equal(x, public) {
+			t.Fatalf("encoding %x decodes to %x, not the public key %x", encoded, x, public)
+		}
+	}
+}
+
+func TestEllSwiftXDHVectors(t *testing.T) {
+	for i, row := range readVectors(t, "bip324_xdh.csv") {
+		secretKey := mustHex(t, row["in_priv_ours"])
+		ours := mustHex(t, row["in_ellswift_ours"])
+		theirs := mustHex(t, row["in_ellswift_theirs"])
+		initiator := row["in_initiating"] == "1"
+
+		public, err := XOnlyPublicKey(secretKey)
+		if err != nil || hex.EncodeToString(public) != row["mid_x_ours"] {
+			t.Errorf("vector %v: public x %x, %v", i, public, err)
+		}
+		theirX, err := EllSwiftDecode(theirs)
+		if err != nil || hex.EncodeToString(theirX) != row["mid_x_theirs"] {
+			t.Errorf("vector %v: their x %x, %v", i, theirX, err)
+		}
+
+		encodingA, encodingB := ours, theirs
+		if !initiator {
+			encodingA, encodingB = theirs, ours
+		}
+		// Blinding is random, run each a few times
+		for j := 0; j < 4; j++ {
+			shared, err := EllSwiftXDH(encodingA, encodingB, secretKey, initiator)
+			if err != nil || hex.EncodeToString(shared) != row["mid_shared_secret"] {
+				t.Errorf("vector %v: shared secret %x, %v", i, shared, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package bitcoin
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+// Regtest genesis headers straight from chainparams, hashes byte reversed as block explorers show them.
+// Both meet their 207fffff bits, the header algorithm is all that differs
+func TestRegtestGenesisHeaders(t *testing.T) {
+	bitcoinGenesis := "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4adae5494dffff7f2002000000"
+	tests := []struct {
+		chain  string
+		header string
+		pow    string // What's checked against the target
+	}{
+		{chain: "bitcoin", header: bitcoinGenesis, pow: "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"},
+		{chain: "bitcoincash", header: bitcoinGenesis, pow: "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"}, // Kept Bitcoin's regtest genesis
+		{
+			chain:  "litecoin", // Scrypt for comparison, its block hash is the sha256d 530827f3..16f9
+			header: "010000000000000000000000000000000000000000000000000000000000000000000000d9ced4ed1130f7b7faad9be25323ffafa33232a17c3edf6cfd97bee6bafbdd97dae5494dffff7f2000000000",
+			pow:    "5adbca3495032eb0f2344f78ad238a3abb56d335b1680f5c289276e0d25a3479",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.chain, func(t *testing.T) {
+			digest, err := GetChain(test.chain).HeaderDigest(test.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pow, _ := reverseHexBytes(digest)
+			if pow != test.pow {
+				t.Fatalf("header digest %v, expected %v", pow, test.pow)
+			}
+
+			target, err := TargetFromBits(headerBits(t, test.header))
+			if err != nil {
+				t.Fatal(err)
+			}
+			powBig, _ := new(big.Int).SetString(pow, 16)
+			targetBig, _ := target.ToBig()
+			if powBig.Cmp(targetBig) > 0 {
+				t.Fatalf("proof of work %v is above target %v", pow, target)
+			}
+		})
+	}
+}
+
+// Shares are stored in 00000000ffff.. difficulty units after ShareMultiplier, so both algorithms use 2^32 hashes per 1.
+// A sha256d miner at stratum difficulty 1 is 2^32 hashes a share, a scrypt one 2^16
+func TestShareMultiplierAndHashrate(t *testing.T) {
+	tests := []struct {
+		chain      string
+		algorithm  string
+		multiplier float64
+	}{
+		{chain: "bitcoin", algorithm: "sha256d", multiplier: 1},
+		{chain: "bitcoincash", algorithm: "sha256d", multiplier: 1},
+		{chain: "namecoin", algorithm: "sha256d", multiplier: 1},
+		{chain: "litecoin", algorithm: "scrypt", multiplier: 65536},
+		{chain: "dogecoin", algorithm: "scrypt", multiplier: 65536},
+	}
+
+	for _, test := range tests {
+		chain := GetChain(test.chain)
+		if chain.HeaderAlgorithm() != test.algorithm {
+			t.Errorf("%v: header algorithm %v, expected %v", test.chain, chain.HeaderAlgorithm(), test.algorithm)
+		}
+		if chain.ShareMultiplier() != test.multiplier {
+			t.Errorf("%v: share multiplier %v, expected %v", test.chain, chain.ShareMultiplier(), test.multiplier)
+		}
+		if HashesPerDifficulty(chain) != math.Pow(2, 32) {
+			t.Errorf("%v: %v hashes per difficulty, expected 2^32", test.chain, HashesPerDifficulty(chain))
+		}
+		if hashesPerShare := HashesPerDifficulty(chain) / chain.ShareMultiplier(); hashesPerShare != math.Pow(2, 32)/test.multiplier {
+			t.Errorf("%v: %v hashes per stratum difficulty 1 share", test.chain, hashesPerShare)
+		}
+	}
+}
+
+// The bitcoincash main ones are the cashaddr spec's examples
+func TestSha256dChainAddresses(t *testing.T) {
+	tests := []struct {
+		chain, network, address, script string
+	}{
+		{"bitcoin", "regtest", "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{"bitcoin", "regtest", "2N3vVYSK5XRgVSGWy21PnsRmBUywSQNdCsf", "a914751e76e8199196d454941c45d1b3a323f1433bd687"},
+		{"bitcoin", "regtest", "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"bitcoin", "regtest", "bcrt1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qzf4jry", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bitcoin", "regtest", "bcrt1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqc8gma6", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{"bitcoincash", "main", "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a", "76a91476a04053bda0a88bda5177b86a15c3b29f55987388ac"},
+		{"bitcoincash", "main", "bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq", "a91476a04053bda0a88bda5177b86a15c3b29f55987387"},
+		{"bitcoincash", "main", "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu", "76a91476a04053bda0a88bda5177b86a15c3b29f55987388ac"},
+		{"bitcoincash", "regtest", "bchreg:qp63uahgrxged4z5jswyt5dn5v3lzsem6c6mz8vuwd", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{"bitcoincash", "regtest", "pp63uahgrxged4z5jswyt5dn5v3lzsem6cd7lgtl4s", "a914751e76e8199196d454941c45d1b3a323f1433bd687"},
+		{"namecoin", "main", "N7FdkoPbHSxKfrSVVbRu3NZtrLqc1oKpAR", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{"namecoin", "regtest", "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r", "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{"namecoin", "regtest", "ncrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kwsfjw6", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+	}
+
+	for _, test := range tests {
+		script, err := AddressScript(GetChain(test.chain), test.network, test.address)
+		if err != nil || script != test.script {
+			t.Errorf("%v %v %v: script %v, %v", test.chain, test.network, test.address, script, err)
+		}
+	}
+}
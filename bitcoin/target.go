@@ -51,28 +51,75 @@ func TargetFromDifficulty(difficulty float64) (Target, big.Accuracy) {
 	return Target(targetHex), bigAccuracy
 }
 
+// Compact nBits, as in a block header: one byte of length then a three byte signed significand.
+// Follows Bitcoin's arith_uint256 SetCompact, negative and overflowing targets are errors.
 func TargetFromBits(bitsHex string) (Target, error) {
-	l := len(bitsHex)
-	if l < 8 {
-		return "", errors.New("string too short")
+	if len(bitsHex) != 8 {
+		return "", errors.New("bits must be 8 hex characters: " + bitsHex)
 	}
-	if l%2 == 0 {
-		return "", errors.New("string must be even length")
-	}
-
-	exponent := bitsHex[:2]
-	exponentValue, err := strconv.ParseInt(exponent, 16, 8)
+	bits, err := strconv.ParseUint(bitsHex, 16, 32)
 	if err != nil {
 		return "", err
 	}
-	significand := bitsHex[3:]
-	significandValue, err := strconv.ParseInt(significand, 16, 8)
-	if err != nil {
-		return "", err
+
+	size := uint(bits >> 24)
+	word := bits & 0x007fffff
+
+	target := new(big.Int)
+	if size <= 3 {
+		target.SetUint64(word >> (8 * (3 - size)))
+	} else {
+		target.Lsh(new(big.Int).SetUint64(word), 8*(size-3))
 	}
 
-	target := significandValue*256 ^ (exponentValue - 3)
-	targetHex := fmt.Sprintf("%x", target)
+	if target.Sign() != 0 && bits&0x00800000 != 0 {
+		return "", errors.New("negative target in bits: " + bitsHex)
+	}
+	if target.BitLen() > 256 {
+		return "", errors.New("target overflows 256 bits: " + bitsHex)
+	}
+
+	return Target(fmt.Sprintf("%064x", target)), nil
+}
+
+// Back to compact nBits, rounding the target down to 3 significant bytes like GetCompact
+func (t *Target) ToBits() (string, error) {
+	target, success := t.ToBig()
+	if !success || target.Sign() < 0 {
+		return "", errors.New("invalid target: " + string(*t))
+	}
+	if target.BitLen() > 256 {
+		return "", errors.New("target overflows 256 bits: " + string(*t))
+	}
+
+	size := uint((target.BitLen() + 7) / 8)
+	var word uint64
+	if size <= 3 {
+		word = target.Uint64() << (8 * (3 - size))
+	} else {
+		word = new(big.Int).Rsh(target, 8*(size-3)).Uint64()
+	}
+
+	// The sign bit is set, move it up a byte so it stays positive
+	if word&0x00800000 != 0 {
+		word >>= 8
+		size++
+	}
+
+	return fmt.Sprintf("%08x", uint64(size)<<24|word), nil
+}
+
+// What getdifficulty would say for these bits
+func DifficultyFromBits(bitsHex string) (float64, error) {
+	target, err := TargetFromBits(bitsHex)
+	if err != nil {
+		return 0, err
+	}
+	targetBig, _ := target.ToBig()
+	if targetBig.Sign() == 0 {
+		return 0, errors.New("zero target in bits: " + bitsHex)
+	}
 
-	return Target(targetHex), nil
+	difficulty, _ := target.ToDifficulty()
+	return difficulty, nil
 }
@@ -0,0 +1,142 @@
+package bitcoin
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+// Bits are big endian here, headers store them little endian at bytes 72-76
+func headerBits(t *testing.T, header string) string {
+	t.Helper()
+	bits, err := reverseHexBytes(header[144:152])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bits
+}
+
+// Real scrypt headers, each one's proof of work has to be under the target its own bits decode to
+func TestTargetFromHeaderBits(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		bits       string
+		target     string
+		difficulty float64
+	}{
+		{
+			name:       "Litecoin genesis",
+			header:     "010000000000000000000000000000000000000000000000000000000000000000000000d9ced4ed1130f7b7faad9be25323ffafa33232a17c3edf6cfd97bee6bafbdd97b9aa8e4ef0ff0f1ecd513f7c",
+			bits:       "1e0ffff0",
+			target:     "00000ffff0000000000000000000000000000000000000000000000000000000",
+			difficulty: 0.000244140625,
+		},
+		{
+			name:       "Dogecoin genesis",
+			header:     "010000000000000000000000000000000000000000000000000000000000000000000000696ad20e2dd4365c7459b4a4a5af743d5e92c6da3229e6532cd605f6533f2a5b24a6a152f0ff0f1e67860100",
+			bits:       "1e0ffff0",
+			target:     "00000ffff0000000000000000000000000000000000000000000000000000000",
+			difficulty: 0.000244140625,
+		},
+		{
+			name:       "Dogecoin 4507400",
+			header:     "04006200a157baac4518053c5d0c1a5313a53a67a818e9e3558eb9aec707d6c102860c8a806a3bcf9bc1fd9428219f71c06bb6a2948883558a7fcc06c16c9fcb8a13bd5fe4709463e14f021ac0995aa9",
+			bits:       "1a024fe1",
+			target:     "000000000000024fe10000000000000000000000000000000000000000000000",
+			difficulty: 7256385.917,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bits := headerBits(t, test.header)
+			if bits != test.bits {
+				t.Fatalf("bits %v, expected %v", bits, test.bits)
+			}
+			target, err := TargetFromBits(bits)
+			if err != nil || string(target) != test.target {
+				t.Fatalf("target %v, %v", target, err)
+			}
+			difficulty, err := DifficultyFromBits(bits)
+			if err != nil || math.Abs(difficulty-test.difficulty) > test.difficulty*1e-9 {
+				t.Fatalf("difficulty %v, %v", difficulty, err)
+			}
+
+			digest, err := ScryptDigest(test.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pow, _ := reverseHexBytes(digest)
+			powBig, _ := new(big.Int).SetString(pow, 16)
+			targetBig, _ := target.ToBig()
+			if powBig.Cmp(targetBig) > 0 {
+				t.Fatalf("proof of work %v is above target %v", pow, target)
+			}
+		})
+	}
+}
+
+// Bitcoin Core's arith_uint256 SetCompact/GetCompact cases, plus the auxblock_example.txt bits
+func TestTargetFromBits(t *testing.T) {
+	tests := []struct {
+		bits       string
+		target     string
+		toBits     string
+		difficulty float64 // 0 when the target is zero
+		err        bool
+	}{
+		{bits: "1d00ffff", target: "00000000ffff0000000000000000000000000000000000000000000000000000", toBits: "1d00ffff", difficulty: 1},
+		{bits: "1a01d8a4", target: "00000000000001d8a40000000000000000000000000000000000000000000000", toBits: "1a01d8a4", difficulty: 9087034.7},
+		{bits: "1a00bf3b", target: "00000000000000bf3b0000000000000000000000000000000000000000000000", toBits: "1a00bf3b", difficulty: 22459296.3},
+		{bits: "00123456", target: "0000000000000000000000000000000000000000000000000000000000000000", toBits: "00000000"},
+		{bits: "01003456", target: "0000000000000000000000000000000000000000000000000000000000000000", toBits: "00000000"},
+		{bits: "01803456", target: "0000000000000000000000000000000000000000000000000000000000000000", toBits: "00000000"},
+		{bits: "01123456", target: "0000000000000000000000000000000000000000000000000000000000000012", toBits: "01120000", difficulty: 1.497751961e+66},
+		{bits: "02008000", target: "0000000000000000000000000000000000000000000000000000000000000080", toBits: "02008000", difficulty: 2.106213695e+65},
+		{bits: "04123456", target: "0000000000000000000000000000000000000000000000000000000012345600", toBits: "04123456", difficulty: 8.827043109e+58},
+		{bits: "05009234", target: "0000000000000000000000000000000000000000000000000000000092340000", toBits: "05009234", difficulty: 1.099096565e+58},
+		{bits: "20123456", target: "1234560000000000000000000000000000000000000000000000000000000000", toBits: "20123456", difficulty: 3.274132259e-09},
+		{bits: "01fedcba", err: true}, // Negative
+		{bits: "04923456", err: true}, // Negative
+		{bits: "ff123456", err: true}, // Overflow
+		{bits: "23000001", err: true}, // Overflow
+		{bits: "1d00fff", err: true},
+		{bits: "1d00fffg", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.bits, func(t *testing.T) {
+			target, err := TargetFromBits(test.bits)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got target %v", target)
+				}
+				if _, err = DifficultyFromBits(test.bits); err == nil {
+					t.Fatal("expected a difficulty error")
+				}
+				return
+			}
+			if err != nil || string(target) != test.target {
+				t.Fatalf("target %v, %v", target, err)
+			}
+
+			bits, err := target.ToBits()
+			if err != nil || bits != test.toBits {
+				t.Fatalf("ToBits %v, %v", bits, err)
+			}
+
+			difficulty, err := DifficultyFromBits(test.bits)
+			if test.difficulty == 0 {
+				if err == nil {
+					t.Fatalf("expected a zero target error, got difficulty %v", difficulty)
+				}
+				return
+			}
+			// The vectors are rounded to 10 significant digits
+			if err != nil || math.Abs(difficulty-test.difficulty) > test.difficulty*1e-9 {
+				t.Fatalf("difficulty %v, %v", difficulty, err)
+			}
+		})
+	}
+}
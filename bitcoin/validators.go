@@ -1,8 +1,5 @@
 package bitcoin
 
-func (b BitcoinBlock) ValidMainnetAddress(address string) bool {
-	return b.chain.ValidMainnetAddress(address)
-}
-func (b BitcoinBlock) ValidTestnetAddress(address string) bool {
-	return b.chain.ValidTestnetAddress(address)
+func (b BitcoinBlock) ValidAddress(network, address string) bool {
+	return ValidAddress(b.chain, network, address)
 }
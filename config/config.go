@@ -42,8 +42,52 @@ type sqlConfig struct {
 	SSLMode  string `json:"sslmode"`
 }
 
+type VardiffConfig struct {
+	Enabled         bool    `json:"enabled"`
+	MinDifficulty   float64 `json:"min_difficulty"`
+	MaxDifficulty   float64 `json:"max_difficulty"`
+	TargetShareTime string  `json:"target_share_time"` // How often we'd like a session to submit a share
+	RetargetTime    string  `json:"retarget_time"`     // How long to collect shares before adjusting
+	VariancePercent float64 `json:"variance_percent"`  // Allowed drift from the target share time before adjusting
+}
+
+type TLSConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Port     string `json:"port"` // Only used by the top level tls listener, ports entries have their own bind
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// Stratum V2 encrypts with Noise instead of TLS
+type NoiseConfig struct {
+	AuthoritySecretKey  string `json:"authority_secret_key"` // Hex secp256k1 key, miners pin its public key. Random each start when empty
+	CertificateValidity string `json:"certificate_validity"` // How long the signed static key is good for
+}
+
+type StratumPortConfig struct {
+	Name           string        `json:"name"`
+	Bind           string        `json:"bind"`     // I.e. "0.0.0.0:3643" or ":3643"
+	Protocol       string        `json:"protocol"` // "v1" (default) or "v2"
+	Difficulty     float64       `json:"difficulty"`
+	Vardiff        VardiffConfig `json:"vardiff"`
+	TLS            TLSConfig     `json:"tls"`
+	Noise          NoiseConfig   `json:"noise"`          // v2 only
+	ProxyProtocol  bool          `json:"proxy_protocol"` // Connections start with a PROXY v1/v2 header from a load balancer
+	MaxConnections int           `json:"max_connections"`
+}
+
+type BanPolicyConfig struct {
+	Enabled        bool    `json:"enabled"`
+	BanDuration    string  `json:"ban_duration"`
+	CheckThreshold uint    `json:"check_threshold"` // Shares from an IP before its invalid ratio is checked
+	InvalidPercent float64 `json:"invalid_percent"`
+	MalformedLimit uint    `json:"malformed_limit"` // Malformed requests from an IP before it's banned
+	Persist        bool    `json:"persist"`         // Keep bans in Postgres across restarts
+}
+
 type apiConfig struct {
-	Port string `json:"port"`
+	Port     string `json:"port"`
+	AdminKey string `json:"admin_key"` // Admin endpoints are disabled without one
 }
 
 type recipient struct {
@@ -60,27 +104,87 @@ type Chain struct {
 type Chains map[string]Chain // chainName => chain payout config
 
 type PayoutsConfig struct {
-	Interval string `json:"interval"`
-	Scheme   string `json:"scheme"`
-	Chains   `json:"chains"`
+	Interval         string `json:"interval"`
+	Scheme           string `json:"scheme"`
+	AuxAddressPolicy string `json:"aux_address_policy"` // "hold" (default) or "donate" aux rewards for miners without an address
+	Chains           `json:"chains"`
+}
+
+// Address version bytes for one network, in decimal since JSON has no hex
+type AddressFormatConfig struct {
+	PubKeyHash uint   `json:"pubkey_hash"`
+	ScriptHash []uint `json:"script_hash"`
+	Bech32HRP  string `json:"bech32_hrp"` // Leave out for chains without segwit
+}
+
+// Enables a Bitcoin family coin that has no Blockchain written for it
+type ChainDefinition struct {
+	Name                 string                         `json:"name"`
+	HeaderAlgorithm      string                         `json:"header_algorithm"`   // "scrypt" or "sha256d"
+	CoinbaseAlgorithm    string                         `json:"coinbase_algorithm"` // Defaults to "sha256d"
+	ShareMultiplier      float64                        `json:"share_multiplier"`
+	MinimumConfirmations uint                           `json:"minimum_confirmations"`
+	Addresses            map[string]AddressFormatConfig `json:"addresses"` // "main", "test" or "regtest" => format
+	BlockTemplateRules   []string                       `json:"gbt_rules"`
+	AuxChainID           int                            `json:"aux_chain_id"`
 }
 
 type Config struct {
-	PoolName           string                   `json:"pool_name"`
-	BlockSignature     string                   `json:"block_signature"`
-	BlockchainNodes    blockChainNodesConfigMap `json:"blockchains"` // Map order in this config file determines primary vs aux nodes.
-	Port               string                   `json:"port"`
-	MaxConnections     int                      `json:"max_connections"`
-	ConnectionTimeout  string                   `json:"connection_timeout"`
-	PoolDifficulty     float64                  `json:"pool_difficulty"`
-	BlockChainOrder    `json:"merged_blockchain_order"`
-	ShareFlushInterval string        `json:"share_flush_interval"`
-	HashrateWindow     string        `json:"hashrate_window"`
-	PoolStatsInterval  string        `json:"pool_stats_interval"`
-	Persister          sqlConfig     `json:"persistence"`
-	API                apiConfig     `json:"api"`
-	Payouts            PayoutsConfig `json:"payouts"`
-	AppStatsInterval   string        `json:"app_stats_interval"`
+	PoolName            string                   `json:"pool_name"`
+	BlockSignature      string                   `json:"block_signature"`
+	BlockchainNodes     blockChainNodesConfigMap `json:"blockchains"` // Map order in this config file determines primary vs aux nodes.
+	Ports               []StratumPortConfig      `json:"ports"`       // Replaces port, tls, pool_difficulty and vardiff when set
+	Port                string                   `json:"port"`
+	TLS                 TLSConfig                `json:"tls"` // Optional encrypted stratum, runs alongside Port
+	ProxyProtocol       bool                     `json:"proxy_protocol"`
+	MaxConnections      int                      `json:"max_connections"`
+	ConnectionTimeout   string                   `json:"connection_timeout"`
+	WriteTimeout        string                   `json:"write_timeout"`   // How long one write to a miner may block before it's dropped
+	SendQueueSize       int                      `json:"send_queue_size"` // Packets buffered per session before it's dropped as too slow
+	PoolDifficulty      float64                  `json:"pool_difficulty"`
+	Vardiff             VardiffConfig            `json:"vardiff"`
+	VersionRollingMask  string                   `json:"version_rolling_mask"` // BIP310 bits miners may roll, hex
+	DefaultWorkerName   string                   `json:"default_worker_name"`  // For logins without a rig ID
+	MaxWorkerNameLength int                      `json:"max_worker_name_length"`
+	BanPolicy           BanPolicyConfig          `json:"ban_policy"`
+	BlockChainOrder     `json:"merged_blockchain_order"`
+	ChainDefinitions    []ChainDefinition `json:"chain_definitions"` // Chains not built in
+	ShareFlushInterval  string            `json:"share_flush_interval"`
+	ShareJournalPath    string            `json:"share_journal_path"` // Optional, keeps unflushed shares on disk instead of in memory
+	HashrateWindow      string            `json:"hashrate_window"`
+	PoolStatsInterval   string            `json:"pool_stats_interval"`
+	Persister           sqlConfig         `json:"persistence"`
+	API                 apiConfig         `json:"api"`
+	Payouts             PayoutsConfig     `json:"payouts"`
+	AppStatsInterval    string            `json:"app_stats_interval"`
+}
+
+// Older configs only have one port, and optionally a TLS one, sharing the pool's difficulty
+func (c *Config) StratumPorts() []StratumPortConfig {
+	if len(c.Ports) > 0 {
+		return c.Ports
+	}
+
+	ports := []StratumPortConfig{{
+		Name:          "default",
+		Bind:          ":" + c.Port,
+		Difficulty:    c.PoolDifficulty,
+		Vardiff:       c.Vardiff,
+		ProxyProtocol: c.ProxyProtocol,
+	}}
+
+	if c.TLS.Enabled {
+		ports = append(ports, StratumPortConfig{
+			Name:          "tls",
+			Bind:          ":" + c.TLS.Port,
+			Difficulty:    c.PoolDifficulty,
+			Vardiff:       c.Vardiff,
+			TLS:           c.TLS,
+			ProxyProtocol: c.ProxyProtocol,
+		})
+	}
+
+	return ports
 }
 
 func LoadConfig(fileName string) *Config {
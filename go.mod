@@ -1,9 +1,14 @@
 module designs.capital/dogepool
 
-go 1.21
+// golang.org/x/crypto v0.35.0 declares go 1.23.0, so that's the floor.
+// The secp256k1 and btcec modules added for Stratum V2 only need go 1.17
+go 1.23.0
+
 toolchain go1.24.1
 
 require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.4
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.1
 	github.com/go-zeromq/zmq4 v0.17.0
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
@@ -11,7 +16,10 @@ require (
 )
 
 require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.1.0 // indirect
 	github.com/go-zeromq/goczmq/v4 v4.2.2 // indirect
 	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 )
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
 	"designs.capital/dogepool/api"
+	"designs.capital/dogepool/bitcoin"
 	"designs.capital/dogepool/config"
 	"designs.capital/dogepool/payouts"
 	"designs.capital/dogepool/persistence"
@@ -21,6 +26,10 @@ func main() {
 		configFileName = "config.json"
 	}
 	configuration := config.LoadConfig(configFileName)
+	registerChains(configuration)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	err := persistence.MakePersister(configuration)
 	if err != nil {
@@ -28,11 +37,22 @@ func main() {
 	}
 
 	rpcManagers := makeRPCManagers(configuration)
-	startPoolServer(configuration, rpcManagers)
+	poolServer := startPoolServer(ctx, configuration, rpcManagers)
 	startStatManager(configuration)
-	startAPIServer(configuration)
-	startPayoutService(configuration, rpcManagers)
-	startAppStatsService(configuration)
+	startAPIServer(configuration, poolServer)
+	payoutsDone := startPayoutService(ctx, configuration, rpcManagers)
+	go startAppStatsService(configuration)
+
+	<-ctx.Done()
+	stop() // A second signal kills us the usual way
+	log.Println("Shutting down")
+
+	poolServer.Shutdown()
+	<-payoutsDone
+
+	err = persistence.Close()
+	logOnError(err)
+	log.Println("Shutdown complete")
 }
 
 func parseCommandLineOptions() string {
@@ -40,33 +60,45 @@ func parseCommandLineOptions() string {
 	return flag.Arg(0)
 }
 
-func startPoolServer(configuration *config.Config, managers map[string]*rpc.Manager) *pool.PoolServer {
+func startPoolServer(ctx context.Context, configuration *config.Config, managers map[string]*rpc.Manager) *pool.PoolServer {
 	poolServer := pool.NewServer(configuration, managers)
-	go poolServer.Start()
-	log.Println("Started Pool on port: " + configuration.Port)
+	go poolServer.Start(ctx)
+	for _, port := range configuration.StratumPorts() {
+		log.Println("Started Pool on: " + port.Bind)
+	}
 	return poolServer
 }
 
-func startAPIServer(configuration *config.Config) {
-	go api.ListenAndServe(configuration)
+func startAPIServer(configuration *config.Config, poolServer *pool.PoolServer) {
+	go api.ListenAndServe(configuration, poolServer)
 	log.Println("Started API on port: " + configuration.API.Port)
 }
 
 func startStatManager(configuration *config.Config) {
 	hashrateWindow := mustParseDuration(configuration.HashrateWindow)
 	statsRecordInterval := mustParseDuration(configuration.PoolStatsInterval)
-	go persistence.UpdateStatsOnInterval(configuration.PoolName, hashrateWindow, statsRecordInterval)
+	hashesPerDifficulty := bitcoin.HashesPerDifficulty(bitcoin.GetChain(configuration.GetPrimary()))
+	go persistence.UpdateStatsOnInterval(configuration.PoolName, hashesPerDifficulty, hashrateWindow, statsRecordInterval)
 	log.Printf("Stat Manager running every %v with a hashrate window of %v\n", statsRecordInterval, hashrateWindow)
 }
 
-func startPayoutService(configuration *config.Config, manager map[string]*rpc.Manager) {
+// The returned channel closes once any payout cycle in progress has finished
+func startPayoutService(ctx context.Context, configuration *config.Config, manager map[string]*rpc.Manager) chan struct{} {
 	interval := mustParseDuration(configuration.Payouts.Interval)
-	go payouts.RunManager(configuration, manager, interval)
+	done := make(chan struct{})
+	go func() {
+		payouts.RunManager(ctx, configuration, manager, interval)
+		close(done)
+	}()
 	log.Printf("Payouts manager running every %v\n", interval)
+	return done
 }
 
 func startAppStatsService(configuration *config.Config) {
 	interval := mustParseDuration(configuration.AppStatsInterval)
+	if interval <= 0 {
+		return
+	}
 	for {
 		var memStats runtime.MemStats
 		runtime.ReadMemStats(&memStats)
@@ -80,6 +112,64 @@ func startAppStatsService(configuration *config.Config) {
 	}
 }
 
+// Built in chains register themselves, the rest come from chain_definitions
+func registerChains(configuration *config.Config) {
+	for _, definition := range configuration.ChainDefinitions {
+		formats := make(map[string]bitcoin.AddressFormat)
+		for network, addresses := range definition.Addresses {
+			format := bitcoin.AddressFormat{
+				PubKeyHash: mustVersionByte(definition.Name, addresses.PubKeyHash),
+				Bech32HRP:  addresses.Bech32HRP,
+			}
+			for _, version := range addresses.ScriptHash {
+				format.ScriptHash = append(format.ScriptHash, mustVersionByte(definition.Name, version))
+			}
+			formats[network] = format
+		}
+
+		chain, err := bitcoin.DescribeChain(bitcoin.ChainDescription{
+			Name:                 definition.Name,
+			HeaderAlgorithm:      definition.HeaderAlgorithm,
+			CoinbaseAlgorithm:    definition.CoinbaseAlgorithm,
+			ShareMultiplier:      definition.ShareMultiplier,
+			MinimumConfirmations: definition.MinimumConfirmations,
+			AddressFormats:       formats,
+			BlockTemplateRules:   definition.BlockTemplateRules,
+			AuxChainID:           definition.AuxChainID,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		bitcoin.RegisterChain(chain)
+		log.Printf("Registered %v from config", definition.Name)
+	}
+
+	if len(configuration.BlockChainOrder) < 1 {
+		log.Fatal("merged_blockchain_order needs at least the primary chain")
+	}
+	for _, chainName := range configuration.BlockChainOrder {
+		if _, exists := bitcoin.LookupChain(chainName); !exists {
+			log.Fatalf("Unknown blockchain %v, describe it in chain_definitions", chainName)
+		}
+	}
+
+	// Aux chains are checked against the parent's header hash, so they have to share its algorithm
+	primary := bitcoin.GetChain(configuration.GetPrimary())
+	for _, chainName := range configuration.BlockChainOrder[1:] {
+		aux := bitcoin.GetChain(chainName)
+		if aux.HeaderAlgorithm() != primary.HeaderAlgorithm() {
+			log.Fatalf("Can't merge mine %v (%v) under %v (%v)", chainName, aux.HeaderAlgorithm(), primary.ChainName(), primary.HeaderAlgorithm())
+		}
+	}
+}
+
+func mustVersionByte(chainName string, version uint) byte {
+	if version > 0xff {
+		log.Fatalf("%v: address version %v doesn't fit in a byte", chainName, version)
+	}
+	return byte(version)
+}
+
 func makeRPCManagers(configuration *config.Config) map[string]*rpc.Manager {
 	managers := make(map[string]*rpc.Manager)
 	for _, chain := range configuration.BlockChainOrder {
@@ -101,6 +191,12 @@ func makeRPCManagers(configuration *config.Config) map[string]*rpc.Manager {
 	return managers
 }
 
+func logOnError(e error) {
+	if e != nil {
+		log.Println(e)
+	}
+}
+
 func mustParseDuration(s string) time.Duration {
 	value, err := time.ParseDuration(s)
 	if err != nil {
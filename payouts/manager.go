@@ -1,6 +1,7 @@
 package payouts
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -9,12 +10,20 @@ import (
 	"designs.capital/dogepool/rpc"
 )
 
-func RunManager(config *config.Config, rpcManagers map[string]*rpc.Manager, interval time.Duration) {
+// A cycle that has started always runs to the end, stopping halfway could
+// mark blocks confirmed without crediting them or pay without recording it.
+// Cancelling ctx only stops the next cycle from starting.
+func RunManager(ctx context.Context, config *config.Config, rpcManagers map[string]*rpc.Manager, interval time.Duration) {
 	var blocks persistence.FoundBlocks
 	var err error
 	var cutoffTime time.Time
 	for {
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			log.Println("Payouts manager stopped")
+			return
+		case <-time.After(interval):
+		}
 
 		log.Println("Checking block confirmations")
 
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"time"
 
@@ -27,13 +28,19 @@ func payoutBalances(config *config.Config, rpcManagers map[string]*rpc.Manager)
 		balances = append(balances, b...)
 	}
 
+	// Addresses are settled before anything is sent, nothing after SendMany may fail on a lookup
+	payable, err := settleUnaddressedBalances(balances, config)
+	if err != nil {
+		return err
+	}
+
 	// Send payments
-	transactionConfirmation, err := bitcoinTryManyPayments(balances, config, rpcManagers)
+	transactionConfirmation, err := bitcoinTryManyPayments(payable, rpcManagers)
 	if err != nil {
 		return err
 	}
 
-	for _, balance := range balances {
+	for _, balance := range payable {
 		confirmation, found := transactionConfirmation[balance.Chain]
 		if !found {
 			m := "failed to find payment confirmation for %v on chain %v"
@@ -42,15 +49,10 @@ func payoutBalances(config *config.Config, rpcManagers map[string]*rpc.Manager)
 		}
 
 		// Record Payments
-		address, err := findBalanceAddress(balance, config)
-		if err != nil {
-			return err
-		}
-
 		err = persistence.Payments.Insert(persistence.Payment{
 			PoolID:                      balance.PoolID,
 			Chain:                       balance.Chain,
-			Address:                     address,
+			Address:                     balance.payTo,
 			Amount:                      balance.Amount,
 			Created:                     time.Now(),
 			TransactionConfirmationData: confirmation,
@@ -71,7 +73,7 @@ func payoutBalances(config *config.Config, rpcManagers map[string]*rpc.Manager)
 }
 
 // TODO move to bitcoin aka the chain package.
-func bitcoinTryManyPayments(balances []persistence.Balance, config *config.Config, rpcManagers map[string]*rpc.Manager) (map[string]string, error) {
+func bitcoinTryManyPayments(balances []payableBalance, rpcManagers map[string]*rpc.Manager) (map[string]string, error) {
 	transactionsGroupedByChain := make(map[string]map[string]float64)
 	transactionConfirmationByChain := make(map[string]string)
 
@@ -81,12 +83,7 @@ func bitcoinTryManyPayments(balances []persistence.Balance, config *config.Confi
 			chainBalances = make(map[string]float64)
 		}
 
-		address, err := findBalanceAddress(balance, config)
-		if err != nil {
-			return transactionConfirmationByChain, err
-		}
-
-		chainBalances[address] = balance.Amount
+		chainBalances[balance.payTo] += balance.Amount // A registered address can also show up in a login
 		transactionsGroupedByChain[balance.Chain] = chainBalances
 	}
 
@@ -113,33 +110,81 @@ func bitcoinTryManyPayments(balances []persistence.Balance, config *config.Confi
 	return transactionConfirmationByChain, nil
 }
 
-// TODO - move this to REWARDS?
-func findBalanceAddress(balance persistence.Balance, config *config.Config) (string, error) {
-	mergedMining := len(config.BlockChainOrder) > 1
-	address := balance.Address
-	if mergedMining {
-		addresses := strings.Split(balance.Address, "-")
+const (
+	auxAddressHold   = "hold"
+	auxAddressDonate = "donate"
+)
+
+var errNoChainAddress = errors.New("miner has no address for chain")
 
-		if len(addresses) == 1 { // Pool reward address
-			return addresses[0], nil
+// A balance and the address it's sent to, which isn't always the balance's own login
+type payableBalance struct {
+	persistence.Balance
+	payTo string
+}
+
+// Miners may log in without their aux addresses. Their aux balances wait for an address
+// to be registered, or go to the pool with the donate policy. Returns what can be paid.
+func settleUnaddressedBalances(balances []persistence.Balance, config *config.Config) ([]payableBalance, error) {
+	var payable []payableBalance
+	for _, balance := range balances {
+		address, err := findBalanceAddress(balance, config)
+		if err == nil {
+			payable = append(payable, payableBalance{Balance: balance, payTo: address})
+			continue
+		} else if !errors.Is(err, errNoChainAddress) {
+			return nil, err
 		}
 
-		found := false
-		i := 0
-		for _, chain := range config.BlockChainOrder {
-			if chain == balance.Chain {
-				found = true
-				break
-			}
-			i++
+		if config.Payouts.AuxAddressPolicy != auxAddressDonate {
+			log.Printf("Holding %v %v for %v until an address is registered", balance.Amount, balance.Chain, balance.Address)
+			continue
 		}
 
-		if !found {
-			return "", errors.New("chain address not found: " + balance.Chain)
+		log.Printf("Donating %v %v from %v to the pool, no address registered", balance.Amount, balance.Chain, balance.Address)
+		usage := "Donated to pool, no " + balance.Chain + " address"
+		err = persistence.Balances.AddAmount(config.PoolName, balance.Chain, balance.Address, usage, balance.Amount*-1)
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	return payable, nil
+}
+
+// TODO - move this to REWARDS?
+func findBalanceAddress(balance persistence.Balance, config *config.Config) (string, error) {
+	mergedMining := len(config.BlockChainOrder) > 1
+	if !mergedMining || isPoolRecipient(balance, config) {
+		return balance.Address, nil
+	}
+
+	i := slices.Index(config.BlockChainOrder, balance.Chain)
+	if i < 0 {
+		return "", errors.New("chain address not found: " + balance.Chain)
+	}
 
-		address = addresses[i]
+	addresses := strings.Split(balance.Address, "-")
+	if i < len(addresses) {
+		return addresses[i], nil
 	}
 
-	return address, nil
+	registered, err := persistence.AuxAddresses.Get(config.PoolName, addresses[0], balance.Chain)
+	if err != nil {
+		return "", err
+	}
+	if registered == nil {
+		return "", errNoChainAddress
+	}
+
+	return registered.AuxAddress, nil
+}
+
+func isPoolRecipient(balance persistence.Balance, config *config.Config) bool {
+	for _, recipient := range config.Payouts.Chains[balance.Chain].PoolRewardRecipients {
+		if recipient.Address == balance.Address {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,56 @@
+package persistence
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Where a miner who logged in without an aux address wants that chain paid
+type AuxAddress struct {
+	PoolID     string
+	Address    string // The miner's primary chain address
+	Chain      string
+	AuxAddress string
+	Created    time.Time
+	Updated    time.Time
+}
+
+type AuxAddressRepository struct {
+	*sql.DB
+}
+
+func (r *AuxAddressRepository) Upsert(address AuxAddress) error {
+	query := `INSERT INTO miner_aux_addresses(poolid, address, chain, auxaddress, created, updated)
+				VALUES($1, $2, $3, $4, now(), now())
+				ON CONFLICT (poolid, address, chain) DO UPDATE SET auxaddress = $4, updated = now()`
+
+	stmt, err := r.DB.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(address.PoolID, address.Address, address.Chain, address.AuxAddress)
+	return err
+}
+
+func (r *AuxAddressRepository) Get(poolID, address, chain string) (*AuxAddress, error) {
+	query := `SELECT poolid, address, chain, auxaddress, created, updated FROM miner_aux_addresses
+				WHERE poolid = $1 AND address = $2 AND chain = $3`
+
+	stmt, err := r.DB.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var auxAddress AuxAddress
+	err = stmt.QueryRow(poolID, address, chain).Scan(&auxAddress.PoolID, &auxAddress.Address,
+		&auxAddress.Chain, &auxAddress.AuxAddress, &auxAddress.Created, &auxAddress.Updated)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &auxAddress, nil
+}
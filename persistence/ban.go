@@ -0,0 +1,83 @@
+package persistence
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Ban struct {
+	PoolID    string
+	IpAddress string
+	Reason    string
+	Expires   time.Time
+	Created   time.Time
+}
+
+type BanRepository struct {
+	*sql.DB
+}
+
+func (r *BanRepository) Upsert(ban Ban) error {
+	query := `INSERT INTO bannedips(poolid, ipaddress, reason, expires, created)
+				VALUES($1, $2, $3, $4, $5)
+				ON CONFLICT (poolid, ipaddress) DO UPDATE SET reason = $3, expires = $4, created = $5`
+
+	stmt, err := r.DB.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(ban.PoolID, ban.IpAddress, ban.Reason, ban.Expires, ban.Created)
+	return err
+}
+
+func (r *BanRepository) Delete(poolID, ipAddress string) error {
+	query := "DELETE FROM bannedips WHERE poolid = $1 AND ipaddress = $2"
+
+	stmt, err := r.DB.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(poolID, ipAddress)
+	return err
+}
+
+func (r *BanRepository) GetActive(poolID string, now time.Time) ([]Ban, error) {
+	query := "SELECT poolid, ipaddress, reason, expires, created FROM bannedips WHERE poolid = $1 AND expires > $2"
+
+	stmt, err := r.DB.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.Query(poolID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var bans []Ban
+	for rows.Next() {
+		var ban Ban
+		err = rows.Scan(&ban.PoolID, &ban.IpAddress, &ban.Reason, &ban.Expires, &ban.Created)
+		if err != nil {
+			return bans, err
+		}
+
+		bans = append(bans, ban)
+	}
+
+	return bans, nil
+}
+
+func (r *BanRepository) DeleteExpired(poolID string, now time.Time) error {
+	query := "DELETE FROM bannedips WHERE poolid = $1 AND expires <= $2"
+
+	stmt, err := r.DB.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(poolID, now)
+	return err
+}
@@ -8,12 +8,16 @@ import (
 )
 
 var (
-	Balances BalanceRepository
-	Blocks   FoundRepository
-	Miners   MinerRepository
-	Payments PaymentRepository
-	Pool     PoolRepository
-	Shares   ShareRepository
+	AuxAddresses AuxAddressRepository
+	Balances     BalanceRepository
+	Bans         BanRepository
+	Blocks       FoundRepository
+	Miners       MinerRepository
+	Payments     PaymentRepository
+	Pool         PoolRepository
+	Shares       ShareRepository
+
+	database *sql.DB
 )
 
 func MakePersister(configuration *config.Config) error {
@@ -27,7 +31,10 @@ func MakePersister(configuration *config.Config) error {
 		return err
 	}
 
+	database = db
+	AuxAddresses = AuxAddressRepository{db}
 	Balances = BalanceRepository{db}
+	Bans = BanRepository{db}
 	Blocks = FoundRepository{db}
 	Miners = MinerRepository{db}
 	Payments = PaymentRepository{db}
@@ -36,3 +43,10 @@ func MakePersister(configuration *config.Config) error {
 
 	return nil
 }
+
+func Close() error {
+	if database == nil {
+		return nil
+	}
+	return database.Close()
+}
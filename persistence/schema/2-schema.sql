@@ -10,6 +10,7 @@ CREATE TABLE shares
 	worker TEXT NULL,
 	useragent TEXT NULL,
 	ipaddress TEXT NOT NULL,
+	port TEXT NULL,
     source TEXT NULL,
 	created TIMESTAMPTZ NOT NULL
 );
@@ -18,6 +19,19 @@ CREATE INDEX IDX_SHARES_POOL_MINER on shares(poolid, miner);
 CREATE INDEX IDX_SHARES_POOL_CREATED ON shares(poolid, created);
 CREATE INDEX IDX_SHARES_POOL_MINER_DIFFICULTY on shares(poolid, miner, difficulty);
 
+CREATE TABLE sharerejects
+(
+	poolid TEXT NOT NULL,
+	miner TEXT NOT NULL,
+	worker TEXT NULL,
+	code INT NOT NULL,
+	reason TEXT NOT NULL,
+	count BIGINT NOT NULL,
+	created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IDX_SHAREREJECTS_POOL_MINER_CREATED on sharerejects(poolid, miner, created);
+
 CREATE TABLE blocks
 (
 	id BIGSERIAL NOT NULL PRIMARY KEY,
@@ -123,4 +137,27 @@ CREATE TABLE minerstats
 
 CREATE INDEX IDX_MINERSTATS_POOL_CREATED on minerstats(poolid, created);
 CREATE INDEX IDX_MINERSTATS_POOL_MINER_CREATED on minerstats(poolid, miner, created);
-CREATE INDEX IDX_MINERSTATS_POOL_MINER_WORKER_CREATED_HASHRATE on minerstats(poolid,miner,worker,created desc,hashrate);
\ No newline at end of file
+CREATE INDEX IDX_MINERSTATS_POOL_MINER_WORKER_CREATED_HASHRATE on minerstats(poolid,miner,worker,created desc,hashrate);
+
+CREATE TABLE bannedips
+(
+	poolid TEXT NOT NULL,
+	ipaddress TEXT NOT NULL,
+	reason TEXT NULL,
+	expires TIMESTAMPTZ NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+
+	primary key(poolid, ipaddress)
+);
+
+CREATE TABLE miner_aux_addresses
+(
+	poolid TEXT NOT NULL,
+	address TEXT NOT NULL,
+	chain TEXT NOT NULL,
+	auxaddress TEXT NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+	updated TIMESTAMPTZ NOT NULL,
+
+	primary key(poolid, address, chain)
+);
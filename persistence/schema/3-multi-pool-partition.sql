@@ -13,6 +13,7 @@ CREATE TABLE shares
 	worker TEXT NULL,
 	useragent TEXT NULL,
 	ipaddress TEXT NOT NULL,
+	port TEXT NULL,
     source TEXT NULL,
 	created TIMESTAMP WITH TIME ZONE NOT NULL
 ) PARTITION BY LIST (poolid);
@@ -0,0 +1,45 @@
+SET ROLE mergedmining;
+
+/* Brings a database set up from an older 2-schema.sql up to date, new installs already have all of this.  Safe to run more than once */
+
+/* Share rejects */
+CREATE TABLE IF NOT EXISTS sharerejects
+(
+	poolid TEXT NOT NULL,
+	miner TEXT NOT NULL,
+	worker TEXT NULL,
+	code INT NOT NULL,
+	reason TEXT NOT NULL,
+	count BIGINT NOT NULL,
+	created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS IDX_SHAREREJECTS_POOL_MINER_CREATED on sharerejects(poolid, miner, created);
+
+/* Stratum port each share arrived on */
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS port TEXT NULL;
+
+/* IP bans kept across restarts */
+CREATE TABLE IF NOT EXISTS bannedips
+(
+	poolid TEXT NOT NULL,
+	ipaddress TEXT NOT NULL,
+	reason TEXT NULL,
+	expires TIMESTAMPTZ NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+
+	primary key(poolid, ipaddress)
+);
+
+/* Aux chain addresses registered after logging in without them */
+CREATE TABLE IF NOT EXISTS miner_aux_addresses
+(
+	poolid TEXT NOT NULL,
+	address TEXT NOT NULL,
+	chain TEXT NOT NULL,
+	auxaddress TEXT NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+	updated TIMESTAMPTZ NOT NULL,
+
+	primary key(poolid, address, chain)
+);
@@ -1,6 +1,7 @@
 SET ROLE mergedmining;
 
 DROP TABLE shares;
+DROP TABLE sharerejects;
 DROP TABLE blocks;
 DROP TABLE balances;
 DROP TABLE payments;
@@ -8,6 +9,8 @@ DROP TABLE balance_changes;
 DROP TABLE miner_settings;
 DROP TABLE poolstats;
 DROP TABLE minerstats;
+DROP TABLE bannedips;
+DROP TABLE miner_aux_addresses;
 
 CREATE TABLE shares
 (
@@ -19,10 +22,22 @@ CREATE TABLE shares
 	worker TEXT NULL,
 	useragent TEXT NULL,
 	ipaddress TEXT NOT NULL,
+	port TEXT NULL,
     source TEXT NULL,
 	created TIMESTAMPTZ NOT NULL
 );
 
+CREATE TABLE sharerejects
+(
+	poolid TEXT NOT NULL,
+	miner TEXT NOT NULL,
+	worker TEXT NULL,
+	code INT NOT NULL,
+	reason TEXT NOT NULL,
+	count BIGINT NOT NULL,
+	created TIMESTAMPTZ NOT NULL
+);
+
 CREATE TABLE blocks
 (
 	id BIGSERIAL NOT NULL PRIMARY KEY,
@@ -116,3 +131,26 @@ CREATE TABLE minerstats
 	sharespersecond DOUBLE PRECISION NOT NULL DEFAULT 0,
 	created TIMESTAMPTZ NOT NULL
 );
+
+CREATE TABLE bannedips
+(
+	poolid TEXT NOT NULL,
+	ipaddress TEXT NOT NULL,
+	reason TEXT NULL,
+	expires TIMESTAMPTZ NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+
+	primary key(poolid, ipaddress)
+);
+
+CREATE TABLE miner_aux_addresses
+(
+	poolid TEXT NOT NULL,
+	address TEXT NOT NULL,
+	chain TEXT NOT NULL,
+	auxaddress TEXT NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+	updated TIMESTAMPTZ NOT NULL,
+
+	primary key(poolid, address, chain)
+);
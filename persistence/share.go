@@ -17,6 +17,7 @@ type Share struct {
 	Difficulty        float64
 	NetworkDifficulty float64
 	IpAddress         string
+	Port              string // Stratum port the share arrived on
 	Created           time.Time
 }
 
@@ -31,7 +32,7 @@ func (r *ShareRepository) InsertBatch(shares []Share) error {
 	}
 
 	fields := pq.CopyIn("shares", "poolid", "blockheight", "difficulty", "networkdifficulty",
-		"miner", "worker", "useragent", "ipaddress", "source", "created")
+		"miner", "worker", "useragent", "ipaddress", "port", "source", "created")
 	stmt, err := txn.Prepare(fields)
 	if err != nil {
 		return err
@@ -40,7 +41,50 @@ func (r *ShareRepository) InsertBatch(shares []Share) error {
 	for _, share := range shares {
 		_, err = stmt.Exec(share.PoolID, share.BlockHeight, share.Difficulty,
 			share.NetworkDifficulty, share.Miner, share.Worker, share.UserAgent, share.IpAddress,
-			"", share.Created)
+			share.Port, "", share.Created)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+type ShareReject struct {
+	PoolID  string
+	Miner   string
+	Worker  string
+	Code    int
+	Reason  string
+	Count   uint
+	Created time.Time
+}
+
+func (r *ShareRepository) InsertRejectBatch(rejects []ShareReject) error {
+	txn, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	fields := pq.CopyIn("sharerejects", "poolid", "miner", "worker", "code", "reason", "count", "created")
+	stmt, err := txn.Prepare(fields)
+	if err != nil {
+		return err
+	}
+
+	for _, reject := range rejects {
+		_, err = stmt.Exec(reject.PoolID, reject.Miner, reject.Worker, reject.Code,
+			reject.Reason, reject.Count, reject.Created)
 		if err != nil {
 			return err
 		}
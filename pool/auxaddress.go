@@ -0,0 +1,73 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"designs.capital/dogepool/bitcoin"
+	"designs.capital/dogepool/persistence"
+)
+
+// How long a message from AuxAddressMessage can be signed and sent back
+const auxAddressSignatureLifetime = 15 * time.Minute
+
+// What the miner signs with their primary address to claim an aux chain's rewards.
+// signedAt comes from the pool, so an old signature can't be replayed once it's stale
+func AuxAddressMessage(poolName, chain, auxAddress string, signedAt int64) string {
+	return fmt.Sprintf("%v: pay my %v rewards to %v, requested at %v", poolName, chain, auxAddress, signedAt)
+}
+
+// For miners who logged in with only some of their addresses.
+// The signature proves they own the primary address the rewards were credited to.
+// Nodes only verify messages signed by P2PKH addresses, miners with any other kind log in as primary-aux instead
+func (pool *PoolServer) RegisterAuxAddress(primaryAddress, chain, auxAddress, signature string, signedAt int64) error {
+	primary := pool.config.GetPrimary()
+	if !slices.Contains(pool.config.BlockChainOrder[1:], chain) {
+		return errors.New("not an aux chain of this pool: " + chain)
+	}
+	script, err := bitcoin.AddressScript(bitcoin.GetChain(primary), pool.activeNodes[primary].Network, primaryAddress)
+	if err != nil {
+		return errors.New("invalid " + primary + " address: " + primaryAddress)
+	}
+	if !strings.HasPrefix(script, "76a914") { // OP_DUP OP_HASH160, P2PKH
+		return errors.New("only legacy P2PKH addresses can sign messages, log in as " + primaryAddress + "-" + auxAddress + " instead")
+	}
+	if !pool.validAddress(chain, auxAddress) {
+		return errors.New("invalid " + chain + " address: " + auxAddress)
+	}
+
+	requested := time.Unix(signedAt, 0)
+	if age := time.Since(requested); age > auxAddressSignatureLifetime || age < -time.Minute {
+		return errors.New("signed message has expired, request a new one")
+	}
+	// A signature from before the current registration would put an older address back
+	registered, err := persistence.AuxAddresses.Get(pool.config.PoolName, primaryAddress, chain)
+	if err != nil {
+		return err
+	}
+	if registered != nil && !requested.After(registered.Updated) {
+		return errors.New("signed message is older than the current registration, request a new one")
+	}
+
+	message := AuxAddressMessage(pool.config.PoolName, chain, auxAddress, signedAt)
+	verified, err := pool.rpcManagers[primary].GetActiveClient().VerifyMessage(primaryAddress, signature, message)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return errors.New("signature does not match " + primaryAddress)
+	}
+
+	log.Printf("Registered %v address %v for miner %v", chain, auxAddress, primaryAddress)
+
+	return persistence.AuxAddresses.Upsert(persistence.AuxAddress{
+		PoolID:     pool.config.PoolName,
+		Address:    primaryAddress,
+		Chain:      chain,
+		AuxAddress: auxAddress,
+	})
+}
@@ -1,35 +1,91 @@
 package pool
 
 import (
+	"context"
+	"errors"
 	"log"
 	"time"
 
 	"designs.capital/dogepool/persistence"
 )
 
-func (pool *PoolServer) startBufferManager() error {
+func (pool *PoolServer) startBufferManager(ctx context.Context) error {
+	if pool.config.ShareJournalPath != "" {
+		journal, err := openShareJournal(pool.config.ShareJournalPath)
+		if err != nil {
+			return err
+		}
+		pool.journal = journal
+		log.Println("Journaling shares to " + pool.config.ShareJournalPath)
+	}
+
 	interval := mustParseDuration(pool.config.ShareFlushInterval)
 	log.Printf("Share buffer flushes every %v\n", pool.config.ShareFlushInterval)
-	go pool.flushShareBufferAtInterval(interval)
+	go pool.flushShareBufferAtInterval(ctx, interval)
 
 	return nil
 }
 
-func (pool *PoolServer) flushShareBufferAtInterval(interval time.Duration) {
+// Shutdown does the final flush, so this just stops
+func (pool *PoolServer) flushShareBufferAtInterval(ctx context.Context, interval time.Duration) {
 	for {
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
 
-		pool.Lock()
-		sharesToWrite := pool.shareBuffer
-		pool.shareBuffer = nil
-		pool.Unlock()
+		err := pool.flushShareBuffer()
+		logOnError(err)
+	}
+}
 
-		err := persistence.Shares.InsertBatch(sharesToWrite)
-		if err != nil {
-			log.Println(err)
-			pool.Lock()
-			pool.shareBuffer = append(pool.shareBuffer, sharesToWrite...)
-			pool.Unlock()
+// With a journal the share is on disk before the miner hears it was accepted
+func (pool *PoolServer) bufferShare(share persistence.Share) error {
+	if pool.journal != nil {
+		return pool.journal.append(share)
+	}
+
+	pool.Lock()
+	pool.shareBuffer = append(pool.shareBuffer, share)
+	pool.Unlock()
+
+	return nil
+}
+
+// Anything that fails to write stays buffered for the next try
+func (pool *PoolServer) flushShareBuffer() error {
+	var shareErr error
+	if pool.journal != nil {
+		shareErr = pool.journal.flush()
+	} else {
+		shareErr = pool.flushMemoryShares()
+	}
+
+	var rejectErr error
+	rejectsToWrite := pool.drainRejectBuffer()
+	if len(rejectsToWrite) > 0 {
+		rejectErr = persistence.Shares.InsertRejectBatch(rejectsToWrite)
+		if rejectErr != nil {
+			pool.restoreRejectBuffer(rejectsToWrite)
 		}
 	}
+
+	return errors.Join(shareErr, rejectErr)
+}
+
+func (pool *PoolServer) flushMemoryShares() error {
+	pool.Lock()
+	sharesToWrite := pool.shareBuffer
+	pool.shareBuffer = nil
+	pool.Unlock()
+
+	err := persistence.Shares.InsertBatch(sharesToWrite)
+	if err != nil {
+		pool.Lock()
+		pool.shareBuffer = append(pool.shareBuffer, sharesToWrite...)
+		pool.Unlock()
+	}
+
+	return err
 }
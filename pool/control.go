@@ -0,0 +1,104 @@
+package pool
+
+import (
+	"errors"
+	"log"
+	"strconv"
+)
+
+// Redirects miners, I.e. ahead of maintenance.  An empty host has them reconnect to us right away,
+// client.reconnect only carries a wait along with a host.
+// Targets one session, one worker or every session of a miner, or with all empty the whole pool.
+// Stratum V2 has no wait, and moves a whole connection, so a proxy's other miners go with it
+func (pool *PoolServer) Reconnect(sessionID, minerAddress, workerName, host, port string, wait int) (int, error) {
+	if host == "" && wait != 0 {
+		return 0, errors.New("wait needs a host to reconnect to")
+	}
+
+	v2Port := uint64(0)
+	if port != "" {
+		var err error
+		v2Port, err = strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return 0, errors.New("invalid port: " + port)
+		}
+	}
+
+	clients, connections, err := targetSessions(sessionID, minerAddress, workerName)
+	if err != nil {
+		return 0, err
+	}
+
+	err = broadcastPacket(clientReconnect(host, port, wait), clients)
+	if err != nil {
+		return 0, err
+	}
+	for _, connection := range connections {
+		logOnError(connection.reconnect(host, uint16(v2Port)))
+	}
+
+	sent := len(clients) + len(connections)
+	if host == "" {
+		log.Printf("Asked %v client(s) to reconnect to us", sent)
+	} else {
+		log.Printf("Asked %v client(s) to reconnect to %v:%v in %vs", sent, host, port, wait)
+	}
+	return sent, nil
+}
+
+// Targets sessions the same way as Reconnect.  Stratum V2 has nothing like show_message, only V1 miners see it
+func (pool *PoolServer) ShowMessage(sessionID, minerAddress, workerName, message string) (int, error) {
+	clients, _, err := targetSessions(sessionID, minerAddress, workerName)
+	if err != nil {
+		return 0, err
+	}
+
+	err = broadcastPacket(clientShowMessage(message), clients)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("Sent message to %v client(s): %v", len(clients), message)
+	return len(clients), nil
+}
+
+// V1 sessions, and the V2 connections carrying a matching channel
+func targetSessions(sessionID, minerAddress, workerName string) ([]*stratumClient, []*v2Connection, error) {
+	var clients []*stratumClient
+	var connections []*v2Connection
+
+	switch {
+	case sessionID != "":
+		client, exists := getSession(sessionID)
+		if exists {
+			clients = append(clients, client)
+		}
+		connections = v2ConnectionsWith(func(session *stratumClient) bool {
+			return session.sessionID == sessionID
+		})
+		if len(clients)+len(connections) < 1 {
+			return nil, nil, errors.New("session not found: " + sessionID)
+		}
+	case minerAddress != "" && workerName != "":
+		clients = sessionsByWorker(minerAddress, workerName)
+		connections = v2ConnectionsWith(func(session *stratumClient) bool {
+			return session.minerAddress == minerAddress && session.workerName == workerName
+		})
+		if len(clients)+len(connections) < 1 {
+			return nil, nil, errors.New("no sessions for worker: " + minerAddress + "." + workerName)
+		}
+	case minerAddress != "":
+		clients = sessionsByMiner(minerAddress)
+		connections = v2ConnectionsWith(func(session *stratumClient) bool {
+			return session.minerAddress == minerAddress
+		})
+		if len(clients)+len(connections) < 1 {
+			return nil, nil, errors.New("no sessions for miner: " + minerAddress)
+		}
+	default:
+		clients = allSessions()
+		connections = allV2Connections()
+	}
+
+	return clients, connections, nil
+}
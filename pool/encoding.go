@@ -10,6 +10,15 @@ func hexStringToByteString(hexStr string) string {
 	return string(bytes)
 }
 
+// I.e. a nonce is 4 bytes, always 8 hex characters
+func isHexOfLength(hexStr string, byteLength int) bool {
+	if len(hexStr) != byteLength*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hexStr)
+	return err == nil
+}
+
 func reverseHexBytes(hex string) string {
 	if len(hex)%2 != 0 {
 		panic("String must be divisible by 2 to be a byte string")
@@ -21,3 +30,19 @@ func reverseHexBytes(hex string) string {
 	}
 	return o
 }
+
+func reverse(b []byte) []byte {
+	reversed := make([]byte, len(b))
+	for i := range b {
+		reversed[len(b)-1-i] = b[i]
+	}
+	return reversed
+}
+
+func bytesOf(value byte, length int) []byte {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = value
+	}
+	return b
+}
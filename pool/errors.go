@@ -0,0 +1,37 @@
+package pool
+
+// Error codes miners and proxies expect from the original stratum spec
+const (
+	stratumErrorOther         = 20
+	stratumErrorJobNotFound   = 21
+	stratumErrorDuplicate     = 22
+	stratumErrorLowDifficulty = 23
+	stratumErrorUnauthorized  = 24
+	stratumErrorNotSubscribed = 25
+)
+
+var stratumErrorMessages = map[int]string{
+	stratumErrorOther:         "Other/Unknown",
+	stratumErrorJobNotFound:   "Job not found (=stale)",
+	stratumErrorDuplicate:     "Duplicate share",
+	stratumErrorLowDifficulty: "Low difficulty share",
+	stratumErrorUnauthorized:  "Unauthorized worker",
+	stratumErrorNotSubscribed: "Not subscribed",
+}
+
+func (e *stratumErrorResponse) Error() string {
+	return e.Message
+}
+
+func newStratumError(code int) *stratumErrorResponse {
+	message, exists := stratumErrorMessages[code]
+	if !exists {
+		code = stratumErrorOther
+		message = stratumErrorMessages[code]
+	}
+
+	return &stratumErrorResponse{
+		Code:    code,
+		Message: message,
+	}
+}
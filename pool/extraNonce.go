@@ -1,13 +1,18 @@
 package pool
 
 import (
+	"errors"
 	"math/rand"
+	"sync"
 	"time"
 )
 
 var extranonces map[string]bool
+var extranoncesLock sync.Mutex
 
 func uniqueExtranonce(length int) string {
+	extranoncesLock.Lock()
+	defer extranoncesLock.Unlock()
 
 	if extranonces == nil {
 		extranonces = make(map[string]bool)
@@ -26,6 +31,79 @@ func uniqueExtranonce(length int) string {
 	return extranonce
 }
 
+func releaseExtranonce(extranonce string) {
+	extranoncesLock.Lock()
+	delete(extranonces, extranonce)
+	extranoncesLock.Unlock()
+}
+
+// Moves a session to a new extranonce1 without reconnecting it.
+// Only sessions that sent mining.extranonce.subscribe understand mining.set_extranonce.
+func (pool *PoolServer) ReassignExtranonce(sessionID string) error {
+	client, exists := getSession(sessionID)
+	if !exists {
+		return errors.New("session not found: " + sessionID)
+	}
+
+	return pool.reassignExtranonce(client)
+}
+
+func (pool *PoolServer) reassignExtranonce(client *stratumClient) error {
+	client.extranonceLock.Lock()
+	if !client.extranonceSubscribed {
+		client.extranonceLock.Unlock()
+		return errors.New("client has not subscribed to extranonce changes: " + client.ip)
+	}
+	// Shares already being mined carry the old extranonce1, it stays reserved until the next job
+	if client.previousExtranonce1 != "" {
+		releaseExtranonce(client.previousExtranonce1)
+	}
+	client.previousExtranonce1 = client.extranonce1
+	client.previousJob = pool.jobs.currentID()
+	client.extranonce1 = uniqueExtranonce(extranonce1Length * 2)
+	extranonce1 := client.extranonce1
+	client.extranonceLock.Unlock()
+
+	err := sendPacket(miningSetExtranonce(extranonce1, extranonce2Length), client)
+	if err != nil {
+		return err
+	}
+
+	// The new extranonce applies from the next job on
+	work, err := pool.generateWorkFromCache(true)
+	if err != nil {
+		return err
+	}
+
+	return sendPacket(miningNotify(work), client)
+}
+
+// The extranonce1 from before the last reassignment, until a job newer than currentJob replaces it
+func (client *stratumClient) previousExtranonce(currentJob string) (string, bool) {
+	client.extranonceLock.Lock()
+	defer client.extranonceLock.Unlock()
+
+	if client.previousExtranonce1 == "" {
+		return "", false
+	}
+	if client.previousJob != currentJob {
+		releaseExtranonce(client.previousExtranonce1)
+		client.previousExtranonce1 = ""
+		return "", false
+	}
+	return client.previousExtranonce1, true
+}
+
+func (client *stratumClient) releaseExtranonces() {
+	client.extranonceLock.Lock()
+	defer client.extranonceLock.Unlock()
+
+	releaseExtranonce(client.extranonce1)
+	if client.previousExtranonce1 != "" {
+		releaseExtranonce(client.previousExtranonce1)
+	}
+}
+
 func randomHex(strlen int) string {
 	rand.Seed(time.Now().UTC().UnixNano())
 	const chars = "0123456789abcdef"
@@ -0,0 +1,156 @@
+package pool
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHashrateWindow = "10m"
+	hashrateIdleWindows   = 6 // Meters idle this many windows are forgotten
+)
+
+// Accepted difficulty per second, exponentially decayed over the window
+type hashrateMeter struct {
+	rate    float64
+	started time.Time
+	updated time.Time
+}
+
+func (m *hashrateMeter) record(difficulty float64, now time.Time, window time.Duration) {
+	if m.started.IsZero() {
+		m.started = now
+	} else {
+		m.rate *= math.Exp(-now.Sub(m.updated).Seconds() / window.Seconds())
+	}
+	m.rate += difficulty / window.Seconds()
+	m.updated = now
+}
+
+func (m *hashrateMeter) difficultyRate(now time.Time, window time.Duration) float64 {
+	if m.started.IsZero() {
+		return 0
+	}
+
+	rate := m.rate * math.Exp(-now.Sub(m.updated).Seconds()/window.Seconds())
+
+	// A new meter hasn't seen a whole window yet, don't under report it
+	warmup := 1 - math.Exp(-now.Sub(m.started).Seconds()/window.Seconds())
+	if warmup < 0.01 {
+		return 0
+	}
+
+	return rate / warmup
+}
+
+type LiveHashrate struct {
+	Hashrate float64            `json:"hashrate"`
+	Workers  map[string]float64 `json:"workers,omitempty"` // Only for a single miner
+	Miners   map[string]float64 `json:"miners,omitempty"`  // Only for the whole pool
+}
+
+// Per worker and miner hashrate from the shares we accept, no database needed
+type hashrateTracker struct {
+	sync.Mutex
+	window              time.Duration
+	hashesPerDifficulty float64 // Depends on the primary chain's algorithm
+	pool                hashrateMeter
+	workers             map[string]map[string]*hashrateMeter
+	miners              map[string]*hashrateMeter
+}
+
+func newHashrateTracker(window time.Duration, hashesPerDifficulty float64) *hashrateTracker {
+	return &hashrateTracker{
+		window:              window,
+		hashesPerDifficulty: hashesPerDifficulty,
+		workers:             make(map[string]map[string]*hashrateMeter),
+		miners:              make(map[string]*hashrateMeter),
+	}
+}
+
+func (t *hashrateTracker) hashrate(meter *hashrateMeter, now time.Time) float64 {
+	return meter.difficultyRate(now, t.window) * t.hashesPerDifficulty
+}
+
+func (t *hashrateTracker) record(miner, worker string, difficulty float64) {
+	now := time.Now()
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.pool.record(difficulty, now, t.window)
+	meterFor(t.miners, miner).record(difficulty, now, t.window)
+
+	workers, exists := t.workers[miner]
+	if !exists {
+		workers = make(map[string]*hashrateMeter)
+		t.workers[miner] = workers
+	}
+	meterFor(workers, worker).record(difficulty, now, t.window)
+}
+
+func meterFor(meters map[string]*hashrateMeter, key string) *hashrateMeter {
+	meter, exists := meters[key]
+	if !exists {
+		meter = &hashrateMeter{}
+		meters[key] = meter
+	}
+	return meter
+}
+
+// The whole pool with its miners, or one miner with its workers
+func (t *hashrateTracker) report(miner string) LiveHashrate {
+	now := time.Now()
+
+	t.Lock()
+	defer t.Unlock()
+
+	if miner == "" {
+		report := LiveHashrate{
+			Hashrate: t.hashrate(&t.pool, now),
+			Miners:   make(map[string]float64),
+		}
+		for address, meter := range t.miners {
+			report.Miners[address] = t.hashrate(meter, now)
+		}
+		return report
+	}
+
+	report := LiveHashrate{Workers: make(map[string]float64)}
+	if meter, exists := t.miners[miner]; exists {
+		report.Hashrate = t.hashrate(meter, now)
+	}
+	for worker, meter := range t.workers[miner] {
+		report.Workers[worker] = t.hashrate(meter, now)
+	}
+	return report
+}
+
+func (t *hashrateTracker) pruneOnInterval(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		cutoff := time.Now().Add(-hashrateIdleWindows * t.window)
+		t.Lock()
+		for miner, meter := range t.miners {
+			if meter.updated.Before(cutoff) {
+				delete(t.miners, miner)
+				delete(t.workers, miner)
+			}
+		}
+		for _, workers := range t.workers {
+			for worker, meter := range workers {
+				if meter.updated.Before(cutoff) {
+					delete(workers, worker)
+				}
+			}
+		}
+		t.Unlock()
+	}
+}
+
+// Live hashrate, the whole pool when miner is empty
+func (pool *PoolServer) LiveHashrate(miner string) LiveHashrate {
+	return pool.hashrates.report(miner)
+}
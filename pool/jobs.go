@@ -0,0 +1,108 @@
+package pool
+
+import (
+	"sync"
+
+	"designs.capital/dogepool/bitcoin"
+)
+
+// Shares for jobs older than this get a stale response
+const jobHistoryLength = 4
+
+type job struct {
+	Pair
+	sync.Mutex
+	submissions map[string]bool // extranonce + ntime + nonce + version => seen
+}
+
+// Returns false if this exact share was already submitted to the job
+func (j *job) firstSubmission(extranonce, nonceTime, nonce, version string) bool {
+	key := extranonce + nonceTime + nonce + version
+
+	j.Lock()
+	defer j.Unlock()
+	if j.submissions[key] {
+		return false
+	}
+	j.submissions[key] = true
+	return true
+}
+
+type jobRegistry struct {
+	sync.RWMutex
+	jobs    map[string]*job // Work[0] job ID => templates the work was built from
+	order   []string
+	current string
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		jobs: make(map[string]*job),
+	}
+}
+
+func (r *jobRegistry) add(jobID string, templates Pair) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.jobs[jobID] = &job{
+		Pair:        templates,
+		submissions: make(map[string]bool),
+	}
+	r.order = append(r.order, jobID)
+	r.current = jobID
+
+	// Dropping the job drops its duplicate share set with it
+	for len(r.order) > jobHistoryLength {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *jobRegistry) get(jobID string) (*job, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	j, exists := r.jobs[jobID]
+	return j, exists
+}
+
+func (r *jobRegistry) currentID() string {
+	r.RLock()
+	defer r.RUnlock()
+	return r.current
+}
+
+// Jobs are made for every chain's new blocks and template refreshes, so an older job's blocks
+// are only stale on the chains whose tip has moved since.  Aux chains are keyed by name
+func (r *jobRegistry) staleChains(j *job) (bool, map[string]bool) {
+	r.RLock()
+	current := r.jobs[r.current]
+	r.RUnlock()
+
+	staleAux := make(map[string]bool)
+	if current == nil || current == j {
+		return false, staleAux
+	}
+
+	primaryStale := current.Template != nil && current.Template.PrevBlockHash != j.Template.PrevBlockHash
+
+	tips := make(map[string]string)
+	for _, auxBlock := range current.AuxBlocks {
+		tips[auxBlock.ChainName] = auxTip(auxBlock)
+	}
+	for _, auxBlock := range j.AuxBlocks {
+		// A chain without work right now is left to its node to accept or not
+		tip, exists := tips[auxBlock.ChainName]
+		staleAux[auxBlock.ChainName] = exists && tip != auxTip(auxBlock)
+	}
+
+	return primaryStale, staleAux
+}
+
+// Aux daemons hand out a new block hash on template refreshes too, the previous block is the tip
+func auxTip(auxBlock bitcoin.AuxBlock) string {
+	if auxBlock.PreviousBlockHash != "" {
+		return auxBlock.PreviousBlockHash
+	}
+	return auxBlock.Hash
+}
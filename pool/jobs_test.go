@@ -0,0 +1,187 @@
+package pool
+
+import (
+	"testing"
+
+	"designs.capital/dogepool/bitcoin"
+)
+
+func jobTemplates(prevBlockHash string, auxBlocks ...bitcoin.AuxBlock) Pair {
+	return Pair{
+		BitcoinBlock: bitcoin.BitcoinBlock{Template: &bitcoin.Template{PrevBlockHash: prevBlockHash}},
+		AuxBlocks:    auxBlocks,
+	}
+}
+
+// A Dogecoin block or a template refresh makes a new job, the Litecoin block on the old one is still good
+func TestStaleChains(t *testing.T) {
+	dogecoin := bitcoin.AuxBlock{ChainName: "dogecoin", Hash: "d1", PreviousBlockHash: "d0"}
+	dogecoinRefreshed := bitcoin.AuxBlock{ChainName: "dogecoin", Hash: "d1'", PreviousBlockHash: "d0"}
+	dogecoinNext := bitcoin.AuxBlock{ChainName: "dogecoin", Hash: "d2", PreviousBlockHash: "d1"}
+	pepecoin := bitcoin.AuxBlock{ChainName: "pepecoin", Hash: "p1"} // No previousblockhash, the hash has to do
+	pepecoinNext := bitcoin.AuxBlock{ChainName: "pepecoin", Hash: "p2"}
+
+	tests := []struct {
+		name         string
+		job          Pair
+		current      Pair
+		primaryStale bool
+		staleAux     map[string]bool
+	}{
+		{
+			name:     "still current",
+			job:      jobTemplates("l0", dogecoin),
+			staleAux: map[string]bool{},
+		},
+		{
+			name:     "aux template refresh",
+			job:      jobTemplates("l0", dogecoin),
+			current:  jobTemplates("l0", dogecoinRefreshed),
+			staleAux: map[string]bool{"dogecoin": false},
+		},
+		{
+			name:     "aux block found",
+			job:      jobTemplates("l0", dogecoin, pepecoin),
+			current:  jobTemplates("l0", dogecoinNext, pepecoin),
+			staleAux: map[string]bool{"dogecoin": true, "pepecoin": false},
+		},
+		{
+			name:     "aux block found without previousblockhash",
+			job:      jobTemplates("l0", dogecoin, pepecoin),
+			current:  jobTemplates("l0", dogecoin, pepecoinNext),
+			staleAux: map[string]bool{"dogecoin": false, "pepecoin": true},
+		},
+		{
+			name:         "primary block found",
+			job:          jobTemplates("l0", dogecoin),
+			current:      jobTemplates("l1", dogecoin),
+			primaryStale: true,
+			staleAux:     map[string]bool{"dogecoin": false},
+		},
+		{
+			name:     "aux chain without work",
+			job:      jobTemplates("l0", dogecoin),
+			current:  jobTemplates("l0"),
+			staleAux: map[string]bool{"dogecoin": false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobs := newJobRegistry()
+			jobs.add("1", test.job)
+			if test.current.Template != nil {
+				jobs.add("2", test.current)
+			}
+			j, _ := jobs.get("1")
+
+			primaryStale, staleAux := jobs.staleChains(j)
+			if primaryStale != test.primaryStale {
+				t.Errorf("primary stale %v, expected %v", primaryStale, test.primaryStale)
+			}
+			if len(staleAux) != len(test.staleAux) {
+				t.Fatalf("stale aux chains %v, expected %v", staleAux, test.staleAux)
+			}
+			for chain, stale := range test.staleAux {
+				if staleAux[chain] != stale {
+					t.Errorf("%v stale %v, expected %v", chain, staleAux[chain], stale)
+				}
+			}
+		})
+	}
+}
+
+func TestCandidateStatus(t *testing.T) {
+	tests := []struct {
+		primary, aux bool
+		status       int
+	}{
+		{true, true, dualCandidate},
+		{true, false, primaryCandidate},
+		{false, true, auxCandidate},
+		{false, false, shareValid},
+	}
+
+	for _, test := range tests {
+		if status := candidateStatus(test.primary, test.aux); status != test.status {
+			t.Errorf("primary %v aux %v: status %v, expected %v", test.primary, test.aux, status, test.status)
+		}
+	}
+}
+
+func TestFirstSubmission(t *testing.T) {
+	jobs := newJobRegistry()
+	jobs.add("1", jobTemplates("l0"))
+	jobs.add("2", jobTemplates("l0"))
+	j, _ := jobs.get("1")
+
+	extranonce, nonceTime, nonce, version := "0000000100000000", "6530a8c2", "1a2b3c4d", "00000000"
+	if !j.firstSubmission(extranonce, nonceTime, nonce, version) {
+		t.Fatal("first submission reported as a duplicate")
+	}
+	if j.firstSubmission(extranonce, nonceTime, nonce, version) {
+		t.Fatal("resubmission accepted")
+	}
+
+	// Any one field changed is different work
+	changed := [][4]string{
+		{"0000000100000001", nonceTime, nonce, version},
+		{"0000000200000000", nonceTime, nonce, version},
+		{extranonce, "6530a8c3", nonce, version},
+		{extranonce, nonceTime, "1a2b3c4e", version},
+		{extranonce, nonceTime, nonce, "00002000"},
+	}
+	for _, fields := range changed {
+		if !j.firstSubmission(fields[0], fields[1], fields[2], fields[3]) {
+			t.Errorf("%v reported as a duplicate", fields)
+		}
+	}
+
+	// Duplicates are per job
+	other, _ := jobs.get("2")
+	if !other.firstSubmission(extranonce, nonceTime, nonce, version) {
+		t.Error("the same share on another job reported as a duplicate")
+	}
+}
+
+// Old jobs and their duplicate sets go once jobHistoryLength newer ones exist
+func TestJobHistory(t *testing.T) {
+	jobs := newJobRegistry()
+	for i := 0; i <= jobHistoryLength; i++ {
+		jobs.add(string(rune('a'+i)), jobTemplates("l0"))
+	}
+
+	if _, exists := jobs.get("a"); exists {
+		t.Error("oldest job kept past the history length")
+	}
+	for i := 1; i <= jobHistoryLength; i++ {
+		if _, exists := jobs.get(string(rune('a' + i))); !exists {
+			t.Errorf("job %c dropped", 'a'+i)
+		}
+	}
+	if current := jobs.currentID(); current != string(rune('a'+jobHistoryLength)) {
+		t.Errorf("current job %v", current)
+	}
+}
+
+func TestIsHexOfLength(t *testing.T) {
+	tests := []struct {
+		value string
+		bytes int
+		valid bool
+	}{
+		{"1a2b3c4d", 4, true},
+		{"1A2B3C4D", 4, true},
+		{"1a2b3c4", 4, false},
+		{"01a2b3c4d", 4, false},
+		{"1a2b3c4g", 4, false},
+		{"0x1a2b3c", 4, false},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		if valid := isHexOfLength(test.value, test.bytes); valid != test.valid {
+			t.Errorf("%q of %v bytes: %v", test.value, test.bytes, valid)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package pool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"designs.capital/dogepool/persistence"
+)
+
+// Append-only file of accepted shares, one JSON object per line.
+// The checkpoint file holds the offset of the first share not yet in Postgres.
+// A crash between a commit and its checkpoint replays that batch, shares are
+// written at least once, never lost.
+type shareJournal struct {
+	sync.Mutex
+	file           *os.File
+	checkpointPath string
+	checkpoint     int64 // Everything before this offset is in Postgres
+	size           int64
+	synced         int64      // Everything before this offset is on disk
+	generation     uint64     // Bumped on every truncate, offsets from before it mean nothing after
+	syncing        sync.Mutex // One fsync at a time, it covers every share written before it started
+	flushing       sync.Mutex // Held for a whole flush so a batch is never inserted twice
+}
+
+func openShareJournal(path string) (*shareJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &shareJournal{
+		file:           file,
+		checkpointPath: path + ".checkpoint",
+	}
+
+	err = journal.recover()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// Drops a partially written last line and reconciles the checkpoint with the file
+func (j *shareJournal) recover() error {
+	info, err := j.file.Stat()
+	if err != nil {
+		return err
+	}
+	j.size = info.Size()
+
+	j.checkpoint, err = readCheckpoint(j.checkpointPath)
+	if err != nil {
+		return err
+	}
+	if j.checkpoint > j.size {
+		// The checkpoint is reset before every truncate, so the file was cut short some other way
+		j.checkpoint = 0
+	}
+
+	pending, err := j.read(j.checkpoint, j.size)
+	if err != nil {
+		return err
+	}
+
+	complete := int64(bytes.LastIndexByte(pending, '\n') + 1)
+	if complete < int64(len(pending)) {
+		log.Printf("Share journal ends in a partial write, dropping %v bytes", int64(len(pending))-complete)
+		j.size = j.checkpoint + complete
+		err = j.file.Truncate(j.size)
+		if err != nil {
+			return err
+		}
+	}
+
+	j.synced = j.size
+
+	log.Printf("Share journal has %v unflushed share(s)", bytes.Count(pending[:complete], []byte{'\n'}))
+
+	return writeCheckpoint(j.checkpointPath, j.checkpoint)
+}
+
+// Returns once the share is on disk, so it's safe to acknowledge.
+// Shares written while an fsync is running share the next one instead of each paying for their own
+func (j *shareJournal) append(share persistence.Share) error {
+	line, err := json.Marshal(share)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.Lock()
+	_, err = j.file.Write(line)
+	if err != nil {
+		j.file.Truncate(j.size) // Don't leave half a line for the next share to land after
+		j.Unlock()
+		return err
+	}
+	j.size += int64(len(line))
+	written, generation := j.size, j.generation
+	j.Unlock()
+
+	return j.sync(written, generation)
+}
+
+func (j *shareJournal) sync(offset int64, generation uint64) error {
+	j.syncing.Lock()
+	defer j.syncing.Unlock()
+
+	j.Lock()
+	// A truncate since means the share was flushed to Postgres, and commit synced the empty file
+	covered := j.generation != generation || j.synced >= offset
+	size, syncGeneration := j.size, j.generation
+	j.Unlock()
+	if covered {
+		return nil // Another share's fsync got this one too
+	}
+
+	err := j.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	j.Lock()
+	if j.generation == syncGeneration {
+		j.synced = max(j.synced, size)
+	}
+	j.Unlock()
+	return nil
+}
+
+// Replays everything past the checkpoint into Postgres
+func (j *shareJournal) flush() error {
+	j.flushing.Lock()
+	defer j.flushing.Unlock()
+
+	j.Lock()
+	start, end := j.checkpoint, j.size
+	j.Unlock()
+
+	if start == end {
+		return nil
+	}
+
+	pending, err := j.read(start, end)
+	if err != nil {
+		return err
+	}
+
+	shares := decodeJournalShares(pending)
+	if len(shares) > 0 {
+		err = persistence.Shares.InsertBatch(shares)
+		if err != nil {
+			return err
+		}
+	}
+
+	return j.commit(end)
+}
+
+func (j *shareJournal) commit(offset int64) error {
+	j.Lock()
+	defer j.Unlock()
+
+	if offset < j.size {
+		err := writeCheckpoint(j.checkpointPath, offset)
+		if err != nil {
+			return err
+		}
+		j.checkpoint = offset
+		return nil
+	}
+
+	// Fully flushed, start the file over so it doesn't grow forever.
+	// The checkpoint goes first, if it can't be written the file is left alone and the batch is retried.
+	// A crash before the truncate replays the batch, like any crash before a checkpoint
+	err := writeCheckpoint(j.checkpointPath, 0)
+	if err != nil {
+		return err
+	}
+	err = j.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	j.checkpoint, j.size, j.synced = 0, 0, 0
+	j.generation++
+
+	return j.file.Sync()
+}
+
+func (j *shareJournal) close() error {
+	j.Lock()
+	defer j.Unlock()
+	return j.file.Close()
+}
+
+func (j *shareJournal) read(start, end int64) ([]byte, error) {
+	pending := make([]byte, end-start)
+	_, err := j.file.ReadAt(pending, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return pending, nil
+}
+
+func decodeJournalShares(pending []byte) []persistence.Share {
+	var shares []persistence.Share
+	scanner := bufio.NewScanner(bytes.NewReader(pending))
+	for scanner.Scan() {
+		var share persistence.Share
+		err := json.Unmarshal(scanner.Bytes(), &share)
+		if err != nil {
+			log.Println("Skipping corrupt share journal entry: " + err.Error())
+			continue
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+func readCheckpoint(path string) (int64, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+}
+
+// Written to the side and renamed over, so a crash never leaves half a number.
+// Both the file and the rename are synced before this returns
+func writeCheckpoint(path string, offset int64) error {
+	temporary := path + ".tmp"
+	file, err := os.OpenFile(temporary, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(strconv.FormatInt(offset, 10))
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Rename(temporary, path)
+	if err != nil {
+		return err
+	}
+
+	directory, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer directory.Close()
+	return directory.Sync()
+}
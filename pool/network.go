@@ -2,99 +2,277 @@ package pool
 
 import (
 	"bufio"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"io"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"designs.capital/dogepool/config"
 )
 
-const extranonce1Length = 4
+const (
+	extranonce1Length = 4
+	extranonce2Length = 4
+)
 
-var numberOfConnections int
+const (
+	stratumV1 = "v1"
+	stratumV2 = "v2"
+)
 
 type stratumClient struct {
-	ip          string
-	login       string
-	extranonce1 string
-	userAgent   string
+	ip                   string
+	login                string
+	minerAddress         string
+	workerName           string
+	extranonce1          string
+	extranonceSubscribed bool
+	previousExtranonce1  string // Still accepted until previousJob is replaced, see reassignExtranonce
+	previousJob          string
+	extranonceLock       sync.Mutex
+	versionRollingMask   uint32
+	userAgent            string
+
+	sessionID  string
+	socket     net.Conn // As accepted, connection may wrap it in PROXY, TLS or Noise
+	connection net.Conn
+	outbound   chan outboundPacket
+	done       chan struct{} // Closed once the connection is torn down
+	port       *stratumPort
+	vardiff    *vardiff
+	channel    *v2Channel // Set when this session is a Stratum V2 standard channel
+}
 
-	sessionID     string
-	connection    net.Conn
-	streamEncoder *json.Encoder
+type stratumPort struct {
+	config      config.StratumPortConfig
+	tls         *tls.Config
+	noise       *noiseIdentity // Stratum V2 ports only
+	connections atomic.Int64
+}
+
+func (port *stratumPort) label() string {
+	if port.config.Name != "" {
+		return port.config.Name
+	}
+	return port.config.Bind
 }
 
 func (pool *PoolServer) listenForConnections() {
 	pool.connectionTimeout = mustParseDuration(pool.config.ConnectionTimeout)
+	pool.writeTimeout = mustParseDuration(pool.config.WriteTimeout)
 
-	addr, err := net.ResolveTCPAddr("tcp", ":"+pool.config.Port)
+	for _, portConfig := range pool.config.StratumPorts() {
+		port := &stratumPort{config: portConfig}
+		var err error
+		if portConfig.Protocol == stratumV2 {
+			port.noise, err = loadNoiseIdentity(portConfig.Noise)
+			panicOnError(err)
+		} else if portConfig.TLS.Enabled {
+			port.tls, err = loadTLSConfig(portConfig.TLS)
+			panicOnError(err)
+		}
+
+		server := listenTCP(portConfig.Bind)
+		m := "Stratum %v port %v listening on %v, difficulty %v, TLS %v"
+		log.Printf(m, portConfig.Protocol, port.label(), portConfig.Bind, portConfig.Difficulty, portConfig.TLS.Enabled)
+
+		pool.Lock()
+		if pool.shuttingDown {
+			pool.Unlock()
+			server.Close()
+			return
+		}
+		pool.listeners = append(pool.listeners, server)
+		pool.Unlock()
+
+		go pool.acceptConnections(server, port)
+	}
+}
+
+func listenTCP(bind string) *net.TCPListener {
+	addr, err := net.ResolveTCPAddr("tcp", bind)
 	if err != nil {
 		panicOnError(err)
 	}
 
 	server, err := net.ListenTCP("tcp", addr)
 	panicOnError(err)
+
+	return server
+}
+
+func (pool *PoolServer) acceptConnections(server *net.TCPListener, port *stratumPort) {
 	defer server.Close()
 
 	for { // Listen for connections
-		if numberOfConnections > pool.config.MaxConnections {
-			log.Println("Maximum number of connections reached")
-			// log.Fatal("Maximum number of connections reached")
-
+		tcpCon, err := server.AcceptTCP()
+		if errors.Is(err, net.ErrClosed) {
+			log.Printf("Stratum port %v closed", port.label())
+			return
+		} else if err != nil {
+			log.Println(err)
 			continue
 		}
+		tcpCon.SetKeepAlive(true)
 
-		con, err := server.AcceptTCP()
+		ip, err := remoteIP(tcpCon)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
-		con.SetKeepAlive(true)
 
-		ip, _, err := net.SplitHostPort(con.RemoteAddr().String())
-		if err != nil {
-			log.Println(err)
+		// Behind a load balancer the real address isn't known until the PROXY header is read
+		if !port.config.ProxyProtocol {
+			if isBanned(ip) {
+				tcpCon.Close()
+				continue
+			}
+
+			log.Println("New Stratum Connection from: " + ip)
+		}
+
+		if pool.config.MaxConnections > 0 && numberOfConnections.Load() >= int64(pool.config.MaxConnections) {
+			log.Println("Maximum number of connections reached, rejecting: " + ip)
+			tcpCon.Close()
 			continue
 		}
 
-		log.Println("New Stratum Connection from: " + ip)
+		if port.config.MaxConnections > 0 && port.connections.Load() >= int64(port.config.MaxConnections) {
+			log.Printf("Maximum number of connections reached on port %v", port.label())
+			tcpCon.Close()
+			continue
+		}
 
-		if isBanned(ip) {
-			con.Close()
+		if !pool.trackSocket(tcpCon) {
+			tcpCon.Close()
 			continue
 		}
 
 		client := &stratumClient{
 			ip:          ip,
 			extranonce1: uniqueExtranonce(extranonce1Length * 2),
-			connection:  con,
+			socket:      tcpCon,
+			connection:  tcpCon,
+			outbound:    make(chan outboundPacket, pool.config.SendQueueSize),
+			done:        make(chan struct{}),
+			port:        port,
+			vardiff:     newVardiff(port.config.Vardiff, port.config.Difficulty),
 		}
 
+		numberOfConnections.Add(1)
+		port.connections.Add(1)
+
 		go pool.openNewConnection(client)
+	}
+}
 
-		numberOfConnections++
+// Counts the connection's handler too, false once Shutdown has started
+func (pool *PoolServer) trackSocket(socket net.Conn) bool {
+	pool.Lock()
+	defer pool.Unlock()
+	if pool.shuttingDown {
+		return false
 	}
+	pool.sockets[socket] = true
+	pool.handlers.Add(1)
+	return true
+}
+
+func (pool *PoolServer) untrackSocket(socket net.Conn) {
+	pool.Lock()
+	delete(pool.sockets, socket)
+	pool.Unlock()
+	pool.handlers.Done()
+}
+
+func (pool *PoolServer) openSockets() []net.Conn {
+	pool.Lock()
+	defer pool.Unlock()
+
+	sockets := make([]net.Conn, 0, len(pool.sockets))
+	for socket := range pool.sockets {
+		sockets = append(sockets, socket)
+	}
+	return sockets
+}
+
+func loadTLSConfig(tlsConfig config.TLSConfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
 }
 
 const maxRequestSize = 1024
 
+func remoteIP(con net.Conn) (string, error) {
+	ip, _, err := net.SplitHostPort(con.RemoteAddr().String())
+	return ip, err
+}
+
+// Reads the load balancer's PROXY header, then starts TLS over whatever follows it
+func (pool *PoolServer) upgradeConnection(client *stratumClient) error {
+	if client.port.config.ProxyProtocol {
+		proxied, err := readProxyHeader(client.connection)
+		if err != nil {
+			return errors.New("bad PROXY header from " + client.ip + ": " + err.Error())
+		}
+		client.connection = proxied
+
+		client.ip, err = remoteIP(proxied)
+		if err != nil {
+			return err
+		}
+		if isBanned(client.ip) {
+			return errors.New("rejected banned client: " + client.ip)
+		}
+
+		log.Println("New Stratum Connection from: " + client.ip)
+	}
+
+	if client.port.tls != nil {
+		client.connection = tls.Server(client.connection, client.port.tls) // Handshakes on the first read
+	}
+
+	return nil
+}
+
 func (pool *PoolServer) openNewConnection(client *stratumClient) {
-	err := pool.handleStratumConnection(client)
-	if err != nil {
-		log.Println(err)
-		removeSession(client.sessionID)
-		client.connection.Close()
-		numberOfConnections--
+	err := pool.upgradeConnection(client)
+	if err == nil {
+		go client.writePackets(pool.writeTimeout)
+
+		if client.port.noise != nil {
+			err = pool.handleV2Connection(client)
+		} else {
+			err = pool.handleStratumConnection(client)
+		}
 	}
+	logOnError(err)
+
+	close(client.done)
+	removeSession(client.sessionID)
+	client.releaseExtranonces()
+	client.connection.Close()
+	numberOfConnections.Add(-1)
+	client.port.connections.Add(-1)
+	pool.untrackSocket(client.socket)
 }
 
 func (pool *PoolServer) handleStratumConnection(client *stratumClient) error {
-	client.streamEncoder = json.NewEncoder(client.connection)
 	connectionBuffer := bufio.NewReaderSize(client.connection, maxRequestSize)
 
 	timeoutTime := time.Now().Add(pool.connectionTimeout)
-	client.connection.SetDeadline(timeoutTime)
+	client.connection.SetReadDeadline(timeoutTime)
 
 	for {
 		payload, isPrefix, err := connectionBuffer.ReadLine()
@@ -105,7 +283,7 @@ func (pool *PoolServer) handleStratumConnection(client *stratumClient) error {
 
 		if isPrefix {
 			log.Println("Socket flood detected from: " + client.ip)
-			banClient(client)
+			banClient(client, "socket flood")
 			return err
 		} else if err != nil {
 			log.Println("Socket read error from: " + client.ip)
@@ -121,8 +299,15 @@ func (pool *PoolServer) handleStratumConnection(client *stratumClient) error {
 	}
 }
 
-func sendPacket(packet any, client *stratumClient) error {
-	return client.streamEncoder.Encode(packet)
+// How the session's worker is keyed in rejects and logs
+func (client *stratumClient) workerKey() string {
+	return client.minerAddress + "." + client.workerName
+}
+
+func (client *stratumClient) getExtranonce1() string {
+	client.extranonceLock.Lock()
+	defer client.extranonceLock.Unlock()
+	return client.extranonce1
 }
 
 func mustParseDuration(s string) time.Duration {
@@ -28,10 +28,6 @@ func (p *PoolServer) GetPrimaryNode() blockChainNode {
 	return p.activeNodes[p.config.GetPrimary()]
 }
 
-func (p *PoolServer) GetAux1Node() blockChainNode {
-	return p.activeNodes[p.config.GetAux1()]
-}
-
 type hashblockCounterMap map[string]uint32 // "blockChainName" => hashblock msg counter
 
 func (pool *PoolServer) loadBlockchainNodes() {
@@ -47,12 +43,10 @@ func (pool *PoolServer) loadBlockchainNodes() {
 		chainInfo, err := rpcClient.GetBlockChainInfo()
 		logFatalOnError(err)
 
-		address, err := rpcClient.ValidateAddress(nodeConfig.RewardTo)
+		chain := bitcoin.GetChain(blockChainName)
+		rewardPubScriptKey, err := bitcoin.AddressScript(chain, chainInfo.Chain, nodeConfig.RewardTo)
 		logFatalOnError(err)
 
-		// TODO this is wayy to bitcoin specific.  Move this to the coin package.
-		rewardPubScriptKey := address.ScriptPubKey
-
 		newNode := blockChainNode{
 			NotifyURL:          nodeConfig.NotifyURL,
 			RPC:                rpcClient,
@@ -66,12 +60,13 @@ func (pool *PoolServer) loadBlockchainNodes() {
 	}
 }
 
-func (pool *PoolServer) listenForBlockNotifications() error {
+// Returns nil once ctx is cancelled, closing the subscriptions on the way out
+func (pool *PoolServer) listenForBlockNotifications(ctx context.Context) error {
 	notifyChannel := make(chan hashBlockResponse)
 	hashblockCounterMap := make(hashblockCounterMap)
 
 	for blockChainName := range pool.activeNodes {
-		subscription, err := pool.createZMQSubscriptionToHashBlock(blockChainName, notifyChannel)
+		subscription, err := pool.createZMQSubscriptionToHashBlock(ctx, blockChainName, notifyChannel)
 		if err != nil {
 			return err
 		}
@@ -79,7 +74,14 @@ func (pool *PoolServer) listenForBlockNotifications() error {
 	}
 
 	for {
-		msg := <-notifyChannel
+		var msg hashBlockResponse
+		select {
+		case <-ctx.Done():
+			log.Println("Stopped listening for block notifications")
+			return nil
+		case msg = <-notifyChannel:
+		}
+
 		chainName := msg.blockChainName
 		prevCount := hashblockCounterMap[chainName]
 		newCount := msg.blockHashCounter
@@ -125,13 +127,14 @@ func (p *PoolServer) submitBlockToChain(block bitcoin.BitcoinBlock) error {
 	return nil
 }
 
-func (p *PoolServer) submitAuxBlock(primaryBlock bitcoin.BitcoinBlock, aux1Block bitcoin.AuxBlock) error {
-	auxpow := bitcoin.MakeAuxPow(primaryBlock)
-	success, err := p.GetAux1Node().RPC.SubmitAuxBlock(aux1Block.Hash, auxpow.Serialize())
+func (p *PoolServer) submitAuxBlock(primaryBlock bitcoin.BitcoinBlock, job Pair, auxIndex int) error {
+	auxBlock := job.AuxBlocks[auxIndex]
+	node := p.activeNodes[auxBlock.ChainName]
+	auxpow := bitcoin.MakeAuxPow(primaryBlock, job.AuxMerkle, auxIndex)
+	success, err := node.RPC.SubmitAuxBlock(auxBlock.Hash, auxpow.Serialize())
 	if !success {
-		nodeName := p.GetAux1Node().ChainName
 		m := "⚠️  %v node failed to submit aux block: %v"
-		m = fmt.Sprintf(m, nodeName, err.Error())
+		m = fmt.Sprintf(m, node.ChainName, err)
 		return errors.New(m)
 	}
 	return err
@@ -143,8 +146,8 @@ type hashBlockResponse struct {
 	blockHashCounter  uint32
 }
 
-func (p *PoolServer) createZMQSubscriptionToHashBlock(blockChainName string, hashBlockChannel chan hashBlockResponse) (zmq4.Socket, error) {
-	sub := zmq4.NewSub(context.Background())
+func (p *PoolServer) createZMQSubscriptionToHashBlock(ctx context.Context, blockChainName string, hashBlockChannel chan hashBlockResponse) (zmq4.Socket, error) {
+	sub := zmq4.NewSub(ctx)
 
 	url := p.activeNodes[blockChainName].NotifyURL
 	err := sub.Dial(url)
@@ -168,6 +171,9 @@ func (p *PoolServer) createZMQSubscriptionToHashBlock(blockChainName string, has
 	go func() {
 		for {
 			msg := logErr(sub.Recv())
+			if ctx.Err() != nil {
+				return
+			}
 
 			if len(msg.Frames) > 2 {
 				var blockHashCounter uint32
@@ -176,11 +182,16 @@ func (p *PoolServer) createZMQSubscriptionToHashBlock(blockChainName string, has
 				blockHashCounter |= uint32(msg.Frames[2][2]) << 16
 				blockHashCounter |= uint32(msg.Frames[2][3]) << 24
 
-				hashBlockChannel <- hashBlockResponse{
+				response := hashBlockResponse{
 					blockChainName:    blockChainName,
 					previousBlockHash: hex.EncodeToString(msg.Frames[1]),
 					blockHashCounter:  blockHashCounter,
 				}
+				select {
+				case hashBlockChannel <- response:
+				case <-ctx.Done():
+					return
+				}
 			}
 
 		}
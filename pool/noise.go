@@ -0,0 +1,243 @@
+package pool
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"designs.capital/dogepool/bitcoin"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// https://github.com/stratum-mining/sv2-spec/blob/main/04-Protocol-Security.md
+const (
+	noiseProtocolName   = "Noise_NX_Secp256k1+EllSwift_ChaChaPoly_SHA256"
+	noiseKeyLength      = 64 // ElligatorSwift encoded public key
+	noiseMACLength      = 16
+	noiseCertificateLen = 74 // version, valid_from, not_valid_after, signature
+	noiseMaxMessage     = 65535
+	noiseMaxPlaintext   = noiseMaxMessage - noiseMACLength
+)
+
+type noiseCipher struct {
+	key   []byte
+	nonce uint64
+}
+
+func (c *noiseCipher) nonceBytes() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], c.nonce)
+	return nonce
+}
+
+func (c *noiseCipher) encrypt(associatedData, plaintext []byte) ([]byte, error) {
+	if c.nonce == math.MaxUint64 {
+		return nil, errors.New("noise nonce exhausted")
+	}
+	aead, err := chacha20poly1305.New(c.key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, c.nonceBytes(), plaintext, associatedData)
+	c.nonce++
+	return ciphertext, nil
+}
+
+func (c *noiseCipher) decrypt(associatedData, ciphertext []byte) ([]byte, error) {
+	if c.nonce == math.MaxUint64 {
+		return nil, errors.New("noise nonce exhausted")
+	}
+	aead, err := chacha20poly1305.New(c.key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, c.nonceBytes(), ciphertext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+	c.nonce++
+	return plaintext, nil
+}
+
+// Noise SymmetricState, the handshake hash and chaining key
+type noiseHandshake struct {
+	h      []byte
+	ck     []byte
+	cipher *noiseCipher // nil until the first MixKey
+}
+
+func newNoiseHandshake() *noiseHandshake {
+	h := sha256.Sum256([]byte(noiseProtocolName))
+	state := &noiseHandshake{
+		h:  h[:],
+		ck: h[:],
+	}
+	state.mixHash(nil) // Empty prologue
+	return state
+}
+
+func (s *noiseHandshake) mixHash(data []byte) {
+	hash := sha256.New()
+	hash.Write(s.h)
+	hash.Write(data)
+	s.h = hash.Sum(nil)
+}
+
+func noiseHKDF(chainingKey, inputKeyMaterial []byte) ([]byte, []byte, error) {
+	reader := hkdf.New(sha256.New, inputKeyMaterial, chainingKey, nil)
+	output := make([]byte, 64)
+	_, err := io.ReadFull(reader, output)
+	if err != nil {
+		return nil, nil, err
+	}
+	return output[:32], output[32:], nil
+}
+
+func (s *noiseHandshake) mixKey(inputKeyMaterial []byte) error {
+	var key []byte
+	var err error
+	s.ck, key, err = noiseHKDF(s.ck, inputKeyMaterial)
+	if err != nil {
+		return err
+	}
+	s.cipher = &noiseCipher{key: key}
+	return nil
+}
+
+func (s *noiseHandshake) encryptAndHash(plaintext []byte) ([]byte, error) {
+	if s.cipher == nil {
+		s.mixHash(plaintext)
+		return plaintext, nil
+	}
+	ciphertext, err := s.cipher.encrypt(s.h, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return ciphertext, nil
+}
+
+// Responder's keys are receive, send
+func (s *noiseHandshake) split() (*noiseCipher, *noiseCipher, error) {
+	initiatorKey, responderKey, err := noiseHKDF(s.ck, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &noiseCipher{key: initiatorKey}, &noiseCipher{key: responderKey}, nil
+}
+
+// The pool's long term identity, miners pin the authority's public key
+type noiseIdentity struct {
+	staticSecret  []byte
+	staticPublic  []byte // ElligatorSwift encoded
+	certificate   []byte // SIGNATURE_NOISE_MESSAGE
+	authorityXKey []byte
+}
+
+// A fresh static key each start, vouched for by the authority key until notValidAfter
+func newNoiseIdentity(authoritySecret []byte, validFrom, notValidAfter uint32) (*noiseIdentity, error) {
+	staticSecret, err := bitcoin.NewSecretKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	staticPublic, err := bitcoin.EllSwiftCreate(staticSecret, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	staticX, err := bitcoin.XOnlyPublicKey(staticSecret)
+	if err != nil {
+		return nil, err
+	}
+	authorityX, err := bitcoin.XOnlyPublicKey(authoritySecret)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate := make([]byte, 10, noiseCertificateLen)
+	binary.LittleEndian.PutUint16(certificate[0:], 0) // Version
+	binary.LittleEndian.PutUint32(certificate[2:], validFrom)
+	binary.LittleEndian.PutUint32(certificate[6:], notValidAfter)
+
+	signed := sha256.Sum256(append(append([]byte{}, certificate...), staticX...))
+	auxRandom := make([]byte, 32)
+	_, err = rand.Read(auxRandom)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := bitcoin.SchnorrSign(authoritySecret, signed[:], auxRandom)
+	if err != nil {
+		return nil, err
+	}
+
+	return &noiseIdentity{
+		staticSecret:  staticSecret,
+		staticPublic:  staticPublic,
+		certificate:   append(certificate, signature...),
+		authorityXKey: authorityX,
+	}, nil
+}
+
+// NX as the responder: <- e  then  -> e, ee, s, es, SIGNATURE_NOISE_MESSAGE
+func (identity *noiseIdentity) respond(connection io.ReadWriter) (*noiseCipher, *noiseCipher, error) {
+	state := newNoiseHandshake()
+
+	initiatorEphemeral := make([]byte, noiseKeyLength)
+	_, err := io.ReadFull(connection, initiatorEphemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	state.mixHash(initiatorEphemeral)
+	state.mixHash(nil) // Empty payload, no key yet
+
+	ephemeralSecret, err := bitcoin.NewSecretKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeralPublic, err := bitcoin.EllSwiftCreate(ephemeralSecret, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := append([]byte{}, ephemeralPublic...)
+	state.mixHash(ephemeralPublic)
+
+	ee, err := bitcoin.EllSwiftXDH(initiatorEphemeral, ephemeralPublic, ephemeralSecret, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = state.mixKey(ee)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptedStatic, err := state.encryptAndHash(identity.staticPublic)
+	if err != nil {
+		return nil, nil, err
+	}
+	message = append(message, encryptedStatic...)
+
+	es, err := bitcoin.EllSwiftXDH(initiatorEphemeral, identity.staticPublic, identity.staticSecret, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = state.mixKey(es)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptedCertificate, err := state.encryptAndHash(identity.certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+	message = append(message, encryptedCertificate...)
+
+	_, err = connection.Write(message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return state.split()
+}
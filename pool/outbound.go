@@ -0,0 +1,121 @@
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWriteTimeout  = "10s"
+	defaultSendQueueSize = 64
+)
+
+type outboundPacket struct {
+	data   []byte
+	fanout *fanout // Set on broadcasts, so we can tell when the last client got them
+}
+
+// Tracks one broadcast until every queued copy has been written or given up on
+type fanout struct {
+	started   time.Time
+	clients   int
+	remaining atomic.Int64
+	failed    atomic.Int64
+}
+
+func newFanout(clients int) *fanout {
+	f := &fanout{
+		started: time.Now(),
+		clients: clients,
+	}
+	f.remaining.Store(int64(clients))
+	return f
+}
+
+func (f *fanout) delivered(ok bool) {
+	if f == nil {
+		return
+	}
+	if !ok {
+		f.failed.Add(1)
+	}
+	if f.remaining.Add(-1) == 0 {
+		m := "Work reached %v client(s) in %v, %v failed"
+		log.Printf(m, f.clients, time.Since(f.started), f.failed.Load())
+	}
+}
+
+// Never blocks, a miner that can't keep up with its queue is dropped instead
+func sendPacket(packet any, client *stratumClient) error {
+	data, err := json.Marshal(packet)
+	if err != nil {
+		return err
+	}
+	return client.enqueue(outboundPacket{data: append(data, '\n')})
+}
+
+func (client *stratumClient) enqueue(packet outboundPacket) error {
+	select {
+	case <-client.done:
+		packet.fanout.delivered(false)
+		return errors.New("client disconnected: " + client.ip)
+	default:
+	}
+
+	select {
+	case client.outbound <- packet:
+		return nil
+	default:
+		packet.fanout.delivered(false)
+		log.Println("Send queue full, dropping: " + client.ip)
+		client.connection.Close()
+		return errors.New("send queue full: " + client.ip)
+	}
+}
+
+func (client *stratumClient) writePackets(timeout time.Duration) {
+	failed := false
+	for {
+		select {
+		case packet := <-client.outbound:
+			if !failed {
+				client.connection.SetWriteDeadline(time.Now().Add(timeout))
+				_, err := client.connection.Write(packet.data)
+				if err != nil {
+					log.Println("Socket write error to: " + client.ip)
+					client.connection.Close() // Wakes the reader so the session is torn down
+					failed = true
+				}
+			}
+			packet.fanout.delivered(!failed)
+		case <-client.done:
+			for {
+				select {
+				case packet := <-client.outbound:
+					packet.fanout.delivered(false)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Encodes once and queues for everyone, the slowest miner only holds up itself
+func broadcastPacket(packet any, clients []*stratumClient) error {
+	data, err := json.Marshal(packet)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tracker := newFanout(len(clients))
+	for _, client := range clients {
+		client.enqueue(outboundPacket{data: data, fanout: tracker})
+	}
+
+	return nil
+}
@@ -4,17 +4,10 @@ import "designs.capital/dogepool/bitcoin"
 
 type Pair struct {
 	bitcoin.BitcoinBlock
-	AuxBlocks []bitcoin.AuxBlock
+	AuxBlocks []bitcoin.AuxBlock     // In merged_blockchain_order, chains without work are left out
+	AuxMerkle *bitcoin.AuxMerkleTree // nil without aux blocks
 }
 
 func (p Pair) GetPrimary() bitcoin.BitcoinBlock {
 	return p.BitcoinBlock
 }
-
-func (p Pair) GetAuxN(n int) *bitcoin.AuxBlock {
-	return &p.AuxBlocks[n]
-}
-
-func (p Pair) GetAux1() *bitcoin.AuxBlock {
-	return p.GetAuxN(0)
-}
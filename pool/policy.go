@@ -1,19 +1,272 @@
 package pool
 
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"designs.capital/dogepool/config"
+	"designs.capital/dogepool/persistence"
+)
+
+type Ban struct {
+	IP      string
+	Reason  string
+	Expires time.Time
+	Created time.Time
+}
+
+type ipStats struct {
+	validShares   uint
+	invalidShares uint
+	malformed     uint
+	lastSeen      time.Time
+}
+
+type banPolicy struct {
+	sync.Mutex
+	config   config.BanPolicyConfig
+	poolID   string
+	duration time.Duration
+	bans     map[string]Ban      // ip => ban
+	stats    map[string]*ipStats // ip => behavior since the last check
+}
+
+var policy *banPolicy
+
+func initiatePolicy(poolID string, cfg config.BanPolicyConfig) {
+	policy = &banPolicy{
+		config: cfg,
+		poolID: poolID,
+		bans:   make(map[string]Ban),
+		stats:  make(map[string]*ipStats),
+	}
+
+	if !cfg.Enabled {
+		return
+	}
+
+	policy.duration = mustParseDuration(cfg.BanDuration)
+
+	if cfg.Persist {
+		bans, err := persistence.Bans.GetActive(poolID, time.Now())
+		logOnError(err)
+		for _, ban := range bans {
+			policy.bans[ban.IpAddress] = Ban{
+				IP:      ban.IpAddress,
+				Reason:  ban.Reason,
+				Expires: ban.Expires,
+				Created: ban.Created,
+			}
+		}
+		log.Printf("Loaded %v active IP bans", len(bans))
+	}
+
+	go policy.expireOnInterval(time.Minute)
+}
+
 func isBanned(ip string) bool {
-	return false
+	policy.Lock()
+	defer policy.Unlock()
+
+	ban, exists := policy.bans[ip]
+	if !exists {
+		return false
+	}
+	if time.Now().After(ban.Expires) {
+		delete(policy.bans, ip)
+		return false
+	}
+
+	return true
 }
 
+// Checks an IP's invalid share ratio once it has sent enough shares to judge
 func surpassedLimitPolicy(ip string) bool {
-	return false
+	policy.Lock()
+	defer policy.Unlock()
+
+	stats, exists := policy.stats[ip]
+	if !exists {
+		return false
+	}
+
+	total := stats.validShares + stats.invalidShares
+	if total < policy.config.CheckThreshold {
+		return false
+	}
+
+	invalidPercent := float64(stats.invalidShares) / float64(total) * 100
+	stats.validShares, stats.invalidShares = 0, 0
+
+	return invalidPercent >= policy.config.InvalidPercent
 }
 
-func banClient(client *stratumClient) {
+func recordShareResult(client *stratumClient, valid bool) {
+	if !policy.config.Enabled {
+		return
+	}
+
+	policy.Lock()
+	stats := policy.statsFor(client.ip)
+	if valid {
+		stats.validShares++
+	} else {
+		stats.invalidShares++
+	}
+	policy.Unlock()
+
+	if surpassedLimitPolicy(client.ip) {
+		banClient(client, fmt.Sprintf("invalid shares over %v%%", policy.config.InvalidPercent))
+	}
+}
+
+func banClient(client *stratumClient, reason string) {
 	removeSession(client.sessionID)
 
-	// BAN IP?  BAN Miner address?
+	if !policy.config.Enabled {
+		return
+	}
+
+	err := banIP(client.ip, reason, policy.duration)
+	logOnError(err)
 }
 
 func markMalformedRequest(client *stratumClient, jsonPayload []byte) {
+	if !policy.config.Enabled {
+		return
+	}
+
+	policy.Lock()
+	stats := policy.statsFor(client.ip)
+	stats.malformed++
+	malformed := stats.malformed
+	policy.Unlock()
+
+	if malformed > policy.config.MalformedLimit {
+		banClient(client, fmt.Sprintf("%v malformed requests", malformed))
+	}
+}
+
+func banIP(ip, reason string, duration time.Duration) error {
+	now := time.Now()
+	ban := Ban{
+		IP:      ip,
+		Reason:  reason,
+		Expires: now.Add(duration),
+		Created: now,
+	}
+
+	policy.Lock()
+	policy.bans[ip] = ban
+	delete(policy.stats, ip)
+	policy.Unlock()
+
+	log.Printf("Banned %v until %v: %v", ip, ban.Expires.Format(time.RFC3339), reason)
+
+	for _, client := range allSessions() {
+		if client.ip == ip {
+			client.connection.Close()
+		}
+	}
+	for _, connection := range allV2Connections() {
+		if connection.client.ip == ip {
+			connection.client.connection.Close()
+		}
+	}
+
+	if !policy.config.Persist {
+		return nil
+	}
+
+	return persistence.Bans.Upsert(persistence.Ban{
+		PoolID:    policy.poolID,
+		IpAddress: ip,
+		Reason:    reason,
+		Expires:   ban.Expires,
+		Created:   ban.Created,
+	})
+}
+
+func unbanIP(ip string) error {
+	policy.Lock()
+	_, exists := policy.bans[ip]
+	delete(policy.bans, ip)
+	policy.Unlock()
+
+	if !exists {
+		return errors.New("ip is not banned: " + ip)
+	}
+
+	log.Println("Unbanned " + ip)
+
+	if !policy.config.Persist {
+		return nil
+	}
+
+	return persistence.Bans.Delete(policy.poolID, ip)
+}
+
+// Call with the policy locked
+func (p *banPolicy) statsFor(ip string) *ipStats {
+	stats, exists := p.stats[ip]
+	if !exists {
+		stats = &ipStats{}
+		p.stats[ip] = stats
+	}
+	stats.lastSeen = time.Now()
+	return stats
+}
+
+func (p *banPolicy) expireOnInterval(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		now := time.Now()
+		p.Lock()
+		for ip, ban := range p.bans {
+			if now.After(ban.Expires) {
+				delete(p.bans, ip)
+			}
+		}
+		for ip, stats := range p.stats {
+			if now.Sub(stats.lastSeen) > p.duration {
+				delete(p.stats, ip)
+			}
+		}
+		p.Unlock()
+
+		if p.config.Persist {
+			err := persistence.Bans.DeleteExpired(p.poolID, now)
+			logOnError(err)
+		}
+	}
+}
+
+// Admin surface
+
+func (pool *PoolServer) BannedIPs() []Ban {
+	now := time.Now()
+
+	policy.Lock()
+	defer policy.Unlock()
+
+	bans := make([]Ban, 0, len(policy.bans))
+	for _, ban := range policy.bans {
+		if now.Before(ban.Expires) {
+			bans = append(bans, ban)
+		}
+	}
+
+	return bans
+}
+
+func (pool *PoolServer) BanIP(ip, reason string, duration time.Duration) error {
+	return banIP(ip, reason, duration)
+}
 
+func (pool *PoolServer) UnbanIP(ip string) error {
+	return unbanIP(ip)
 }
@@ -0,0 +1,146 @@
+package pool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PROXY protocol from a load balancer in front of the stratum ports
+// https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyV1MaxLength   = 107
+	proxyV2HeaderSize  = 16
+	proxyHeaderTimeout = 5 * time.Second
+)
+
+// Reads through whatever was buffered past the header, reports the original client
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr // nil for health checks and unknown protocols, the balancer's own address is used
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// The header is required, anything else on a proxied port is dropped
+func readProxyHeader(con net.Conn) (*proxyConn, error) {
+	con.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer con.SetReadDeadline(time.Time{})
+
+	proxied := &proxyConn{
+		Conn:   con,
+		reader: bufio.NewReader(con),
+	}
+
+	signature, err := proxied.reader.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(signature, proxyV2Signature) {
+		proxied.remote, err = readProxyV2(proxied.reader)
+	} else if bytes.HasPrefix(signature, []byte("PROXY ")) {
+		proxied.remote, err = readProxyV1(proxied.reader)
+	} else {
+		err = errors.New("missing PROXY protocol header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return proxied, nil
+}
+
+// I.e. "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readProxyV1(reader *bufio.Reader) (net.Addr, error) {
+	line, err := reader.ReadSlice('\n')
+	if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	if len(line) > proxyV1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY v1 header too long")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", strings.TrimSpace(string(line)))
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed PROXY v1 source %v:%v", fields[2], fields[4])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, proxyV2HeaderSize)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+
+	versionCommand, family := header[12], header[13]
+	if versionCommand>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY v2 version %v", versionCommand>>4)
+	}
+
+	addresses := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	_, err = io.ReadFull(reader, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	const local, proxy = 0x0, 0x1
+	switch versionCommand & 0x0f {
+	case local: // Balancer health check
+		return nil, nil
+	case proxy:
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 command %v", versionCommand&0x0f)
+	}
+
+	// Source and destination address, then source and destination port. TLVs after are ignored
+	var ipLength int
+	switch family >> 4 {
+	case 0x1:
+		ipLength = net.IPv4len
+	case 0x2:
+		ipLength = net.IPv6len
+	default: // Unspecified or unix sockets
+		return nil, nil
+	}
+	if len(addresses) < ipLength*2+4 {
+		return nil, errors.New("PROXY v2 address block too short")
+	}
+
+	ip := net.IP(addresses[:ipLength])
+	port := binary.BigEndian.Uint16(addresses[ipLength*2:])
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
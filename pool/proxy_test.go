@@ -0,0 +1,111 @@
+package pool
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+const proxyTestPayload = `{"id":1,"method":"mining.subscribe","params":[]}` + "\n"
+
+func proxyV2Header(command, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func proxyV2Addresses(source, destination net.IP, sourcePort, destinationPort uint16) []byte {
+	addresses := append(append([]byte{}, source...), destination...)
+	addresses = binary.BigEndian.AppendUint16(addresses, sourcePort)
+	return binary.BigEndian.AppendUint16(addresses, destinationPort)
+}
+
+// Sends header then closes, so truncated headers hit EOF instead of the header timeout
+func readTestProxyHeader(t *testing.T, header []byte) (*proxyConn, error) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { server.Close() })
+
+	go func() {
+		client.Write(header)
+		client.Close()
+	}()
+
+	return readProxyHeader(server)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4Source, ipv4Destination := net.ParseIP("192.168.0.1").To4(), net.ParseIP("192.168.0.11").To4()
+	ipv6Source, ipv6Destination := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	ipv4Addresses := proxyV2Addresses(ipv4Source, ipv4Destination, 56324, 3643)
+	versionOne := proxyV2Header(0x1, 0x11, ipv4Addresses)
+	versionOne[12] = 0x11
+
+	tests := []struct {
+		name   string
+		header []byte
+		remote string // Empty when the balancer's own address should be used
+		err    bool
+	}{
+		{name: "v1 tcp4", header: []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 3643\r\n"), remote: "192.168.0.1:56324"},
+		{name: "v1 tcp6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 3643\r\n"), remote: "[2001:db8::1]:56324"},
+		{name: "v1 unknown", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 unknown with addresses", header: []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n")},
+		{name: "v1 udp", header: []byte("PROXY UDP4 192.168.0.1 192.168.0.11 56324 3643\r\n"), err: true},
+		{name: "v1 missing port", header: []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n"), err: true},
+		{name: "v1 bad address", header: []byte("PROXY TCP4 192.168.0.256 192.168.0.11 56324 3643\r\n"), err: true},
+		{name: "v1 bad port", header: []byte("PROXY TCP4 192.168.0.1 192.168.0.11 65536 3643\r\n"), err: true},
+		{name: "v1 bare newline", header: []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 3643\n"), err: true},
+		{name: "v1 too long", header: []byte("PROXY TCP6 " + strings.Repeat("f", 100) + "\r\n"), err: true},
+		{name: "v1 truncated", header: []byte("PROXY TCP4 192.168.0.1 192.1"), err: true},
+		{name: "v2 tcp4", header: proxyV2Header(0x1, 0x11, ipv4Addresses), remote: "192.168.0.1:56324"},
+		{name: "v2 tcp6", header: proxyV2Header(0x1, 0x21, proxyV2Addresses(ipv6Source, ipv6Destination, 56324, 3643)), remote: "[2001:db8::1]:56324"},
+		{name: "v2 with tlvs", header: proxyV2Header(0x1, 0x11, append(ipv4Addresses, 0x04, 0x00, 0x01, 0x00)), remote: "192.168.0.1:56324"},
+		{name: "v2 local", header: proxyV2Header(0x0, 0x00, nil)},
+		{name: "v2 unspecified family", header: proxyV2Header(0x1, 0x00, nil)},
+		{name: "v2 unix", header: proxyV2Header(0x1, 0x31, make([]byte, 216))},
+		{name: "v2 version 1", header: versionOne, err: true},
+		{name: "v2 unknown command", header: proxyV2Header(0x2, 0x11, ipv4Addresses), err: true},
+		{name: "v2 short addresses", header: proxyV2Header(0x1, 0x21, ipv4Addresses), err: true},
+		{name: "v2 truncated header", header: proxyV2Header(0x1, 0x11, ipv4Addresses)[:14], err: true},
+		{name: "v2 truncated addresses", header: proxyV2Header(0x1, 0x11, ipv4Addresses)[:20], err: true},
+		{name: "v2 truncated signature", header: proxyV2Signature[:6], err: true},
+		{name: "no header", header: []byte(proxyTestPayload), err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := test.header
+			if !test.err {
+				header = append(append([]byte{}, header...), proxyTestPayload...)
+			}
+
+			proxied, err := readTestProxyHeader(t, header)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got remote %v", proxied.RemoteAddr())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.remote == "" && proxied.remote != nil {
+				t.Errorf("remote %v, expected the balancer's address", proxied.remote)
+			}
+			if test.remote != "" && (proxied.remote == nil || proxied.remote.String() != test.remote) {
+				t.Errorf("remote %v, expected %v", proxied.remote, test.remote)
+			}
+
+			// Whatever came after the header reaches the stratum reader untouched
+			rest, err := io.ReadAll(proxied)
+			if err != nil || string(rest) != proxyTestPayload {
+				t.Errorf("after the header %q, %v", rest, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package pool
+
+import (
+	"time"
+
+	"designs.capital/dogepool/persistence"
+)
+
+type rejectKey struct {
+	miner  string
+	worker string
+	code   int
+}
+
+// Counts start over daily so workers that left don't pile up
+const rejectCountPeriod = 24 * time.Hour
+
+// Returns how many shares this worker has had rejected for the same reason today
+func (pool *PoolServer) countRejectedShare(miner, worker string, code int) uint {
+	key := rejectKey{
+		miner:  miner,
+		worker: worker,
+		code:   code,
+	}
+
+	pool.Lock()
+	defer pool.Unlock()
+	if time.Since(pool.rejectedSince) >= rejectCountPeriod {
+		pool.rejectedShares = make(map[rejectKey]uint)
+		pool.rejectedSince = time.Now()
+	}
+	pool.rejectedShares[key]++
+	pool.rejectBuffer[key]++
+
+	return pool.rejectedShares[key]
+}
+
+func (pool *PoolServer) drainRejectBuffer() []persistence.ShareReject {
+	pool.Lock()
+	defer pool.Unlock()
+
+	now := time.Now()
+	rejects := make([]persistence.ShareReject, 0, len(pool.rejectBuffer))
+	for key, count := range pool.rejectBuffer {
+		rejects = append(rejects, persistence.ShareReject{
+			PoolID:  pool.config.PoolName,
+			Miner:   key.miner,
+			Worker:  key.worker,
+			Code:    key.code,
+			Reason:  stratumErrorMessages[key.code],
+			Count:   count,
+			Created: now,
+		})
+	}
+	pool.rejectBuffer = make(map[rejectKey]uint)
+
+	return rejects
+}
+
+func (pool *PoolServer) restoreRejectBuffer(rejects []persistence.ShareReject) {
+	pool.Lock()
+	defer pool.Unlock()
+
+	for _, reject := range rejects {
+		key := rejectKey{
+			miner:  reject.Miner,
+			worker: reject.Worker,
+			code:   reject.Code,
+		}
+		pool.rejectBuffer[key] += reject.Count
+	}
+}
@@ -29,10 +29,16 @@ func miningNotify(work bitcoin.Work) stratumRequest {
 	return request
 }
 
-func miningSetExtranonce(extranonce string) stratumRequest {
+func miningSetExtranonce(extranonce1 string, extranonce2Length int) stratumRequest {
 	var request stratumRequest
 
-	// TODO build request; I need a better example
+	request.Method = "mining.set_extranonce"
+
+	params := []any{extranonce1, extranonce2Length}
+
+	var err error
+	request.Params, err = json.Marshal(params)
+	logOnError(err)
 
 	return request
 }
@@ -50,3 +56,34 @@ func miningSetDifficulty(difficulty float64) stratumRequest {
 
 	return request
 }
+
+// Without a host, miners reconnect to the address they're already using
+func clientReconnect(host, port string, wait int) stratumRequest {
+	var request stratumRequest
+
+	request.Method = "client.reconnect"
+
+	params := []any{}
+	if host != "" {
+		params = []any{host, port, wait}
+	}
+
+	var err error
+	request.Params, err = json.Marshal(params)
+	logOnError(err)
+
+	return request
+}
+
+// Shown on the miner's console, for maintenance notices and announcements
+func clientShowMessage(message string) stratumRequest {
+	var request stratumRequest
+
+	request.Method = "client.show_message"
+
+	var err error
+	request.Params, err = json.Marshal([]string{message})
+	logOnError(err)
+
+	return request
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,7 +36,7 @@ func (pool *PoolServer) respondToStratumClient(client *stratumClient, requestPay
 	}
 
 	timeoutTime := time.Now().Add(pool.connectionTimeout)
-	client.connection.SetDeadline(timeoutTime)
+	client.connection.SetReadDeadline(timeoutTime)
 
 	response, err := handleStratumRequest(&request, client, pool)
 	if err != nil {
@@ -52,8 +54,12 @@ func handleStratumRequest(request *stratumRequest, client *stratumClient, pool *
 		return miningAuthorize(request, client, pool)
 	case "mining.extranonce.subscribe":
 		return miningExtranonceSubscribe(request, client)
+	case "mining.configure":
+		return miningConfigure(request, client, pool)
 	case "mining.submit":
 		return miningSubmit(request, client, pool)
+	case "mining.suggest_difficulty":
+		return miningSuggestDifficulty(request, client, pool)
 	case "mining.multi_version":
 		return nil, nil // ignored
 	default:
@@ -86,8 +92,8 @@ func miningSubscribe(request *stratumRequest, client *stratumClient) (stratumRes
 	var subscriptions []interface{}
 	difficulty := interface{}([]string{"mining.set_difficulty", client.sessionID})
 	notify := interface{}([]string{"mining.notify", client.sessionID})
-	extranonce1 := interface{}(client.extranonce1)
-	extranonce2Length := interface{}(4)
+	extranonce1 := interface{}(client.getExtranonce1())
+	extranonce2Length := interface{}(extranonce2Length)
 
 	subscriptions = append(subscriptions, difficulty)
 	subscriptions = append(subscriptions, notify)
@@ -124,39 +130,30 @@ func miningAuthorize(request *stratumRequest, client *stratumClient, pool *PoolS
 		Id:     request.Id,
 	}
 
-	loginString := params[0]
-	loginParts := strings.Split(loginString, ".")
-	minerAddressesString := loginParts[0]
-	// minerAddressString format: primarycoinAddress-auxcoinAddress-auxcoinAddress.rigID
-	minerAddresses := strings.Split(minerAddressesString, "-")
-	if len(minerAddresses) != len(pool.config.BlockChainOrder) {
-		return authResponse, errors.New("not enough miner addresses to login")
+	if client.sessionID == "" {
+		authResponse.Error = newStratumError(stratumErrorNotSubscribed)
+		return authResponse, nil
 	}
 
-	rigID := loginParts[1]
+	loginString := params[0]
+	minerAddressesString, rigID, err := pool.parseLogin(loginString, client.ip)
+	if err != nil {
+		return authResponse, err
+	}
 
-	// The config has the primarycoinAddress-auxcoinAddress-auxcoinAddress order we need
-	blockchainIndex := 0
-	for _, blockChainName := range pool.config.BlockChainOrder {
-		blockChain := bitcoin.GetChain(blockChainName)
-		inputBlockChainAddress := minerAddresses[blockchainIndex]
-
-		network := pool.activeNodes[blockChainName].Network
-		if (network == "test" && !blockChain.ValidTestnetAddress(inputBlockChainAddress)) ||
-			(network == "main" && !blockChain.ValidMainnetAddress(inputBlockChainAddress)) {
-			m := "invalid %v %vnet miner address from %v: %v"
-			m = fmt.Sprintf(m, blockChainName, network, client.ip, inputBlockChainAddress)
-			return authResponse, errors.New(m)
+	if len(params) > 1 {
+		if hint, exists := passwordDifficulty(params[1]); exists {
+			client.vardiff.suggest(hint) // Goes out with the first set_difficulty below
 		}
-
-		blockchainIndex++
 	}
 
-	log.Printf("Authorized rig: %v mining to addresses: %v", rigID, minerAddresses)
+	log.Printf("Authorized rig: %v mining to addresses: %v", rigID, minerAddressesString)
 
 	client.login = loginString
+	client.minerAddress = minerAddressesString
+	client.workerName = rigID
 
-	addSession(client)
+	addSession(client, minerAddressesString, rigID)
 
 	authResponse.Result = interface{}(true)
 
@@ -165,7 +162,7 @@ func miningAuthorize(request *stratumRequest, client *stratumClient, pool *PoolS
 		return reply, err
 	}
 
-	err = sendPacket(miningSetDifficulty(pool.config.PoolDifficulty), client) // Mining.Auth replies with three packets (2)
+	err = sendPacket(miningSetDifficulty(client.vardiff.difficulty()), client) // Mining.Auth replies with three packets (2)
 	if err != nil {
 		return reply, err
 	}
@@ -181,13 +178,153 @@ func miningAuthorize(request *stratumRequest, client *stratumClient, pool *PoolS
 }
 
 func miningExtranonceSubscribe(request *stratumRequest, client *stratumClient) (stratumResponse, error) {
-	var response stratumResponse
+	response := stratumResponse{
+		Id: request.Id,
+	}
+
+	client.extranonceLock.Lock()
+	client.extranonceSubscribed = true
+	client.extranonceLock.Unlock()
+
+	response.Result = interface{}(true)
+
+	return response, nil
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0310.mediawiki
+func miningConfigure(request *stratumRequest, client *stratumClient, pool *PoolServer) (stratumResponse, error) {
+	response := stratumResponse{
+		Id: request.Id,
+	}
+
+	var params []json.RawMessage
+	err := json.Unmarshal(request.Params, &params)
+	if err != nil {
+		return response, err
+	}
+	if len(params) < 1 {
+		return response, errors.New("invalid mining.configure parameters")
+	}
+
+	var extensions []string
+	err = json.Unmarshal(params[0], &extensions)
+	if err != nil {
+		return response, err
+	}
+
+	extensionParams := make(map[string]json.RawMessage)
+	if len(params) > 1 {
+		err = json.Unmarshal(params[1], &extensionParams)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	result := make(map[string]any)
+	for _, extension := range extensions {
+		switch extension {
+		case "version-rolling":
+			if pool.versionMask == 0 {
+				result["version-rolling"] = false
+				continue
+			}
+
+			minerMask := uint64(0xffffffff)
+			var minerMaskHex string
+			if json.Unmarshal(extensionParams["version-rolling.mask"], &minerMaskHex) == nil {
+				minerMask, err = strconv.ParseUint(minerMaskHex, 16, 32)
+				if err != nil {
+					return response, err
+				}
+			}
+
+			client.versionRollingMask = pool.versionMask & uint32(minerMask)
+			result["version-rolling"] = true
+			result["version-rolling.mask"] = fmt.Sprintf("%08x", client.versionRollingMask)
+		case "minimum-difficulty":
+			var minimum float64
+			err = json.Unmarshal(extensionParams["minimum-difficulty.value"], &minimum)
+			if err != nil || minimum <= 0 {
+				result["minimum-difficulty"] = false
+				continue
+			}
+
+			client.vardiff.setMinimum(minimum)
+			result["minimum-difficulty"] = true
+		case "subscribe-extranonce":
+			client.extranonceLock.Lock()
+			client.extranonceSubscribed = true
+			client.extranonceLock.Unlock()
+			result["subscribe-extranonce"] = true
+		}
+	}
 
-	// TODO - I need to find a good example for this one
+	response.Result = result
 
 	return response, nil
 }
 
+// Before authorize it sets the starting difficulty, after it retargets straight away
+func miningSuggestDifficulty(request *stratumRequest, client *stratumClient, pool *PoolServer) (stratumResponse, error) {
+	response := stratumResponse{
+		Result: interface{}(false),
+		Id:     request.Id,
+	}
+
+	var params []json.RawMessage
+	err := json.Unmarshal(request.Params, &params)
+	if err != nil {
+		return response, err
+	}
+	if len(params) < 1 {
+		return response, errors.New("invalid mining.suggest_difficulty parameters")
+	}
+
+	// Some firmware quotes the number
+	var suggested float64
+	var suggestedString string
+	if json.Unmarshal(params[0], &suggested) != nil {
+		err = json.Unmarshal(params[0], &suggestedString)
+		if err != nil {
+			return response, err
+		}
+		suggested, err = strconv.ParseFloat(suggestedString, 64)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	difficulty, changed := client.vardiff.suggest(suggested)
+	if changed && client.login != "" {
+		err = client.setDifficulty(pool, difficulty)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	response.Result = interface{}(true)
+
+	return response, nil
+}
+
+// I.e. "d=4096", "x,d=4096" or "d=4096;x"
+func passwordDifficulty(password string) (float64, bool) {
+	fields := strings.FieldsFunc(password, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' '
+	})
+	for _, field := range fields {
+		key, value, found := strings.Cut(field, "=")
+		if !found || !strings.EqualFold(key, "d") {
+			continue
+		}
+		difficulty, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return difficulty, true
+		}
+	}
+	return 0, false
+}
+
 func miningSubmit(request *stratumRequest, client *stratumClient, pool *PoolServer) (stratumResponse, error) {
 	response := stratumResponse{
 		Result: interface{}(false),
@@ -200,12 +337,131 @@ func miningSubmit(request *stratumRequest, client *stratumClient, pool *PoolServ
 		return response, err
 	}
 
-	err = pool.recieveWorkFromClient(work, client)
+	// Same parser as authorize, so "addr.rig" and "addr_rig" are the same worker.
+	// Rejects always go to the session's own worker, whatever name was submitted
+	authorized := client.login != ""
+	if len(work) > 0 {
+		submittedWorker, _ := work[0].(string)
+		minerAddress, rigID, err := pool.splitLogin(submittedWorker)
+		authorized = authorized && err == nil && minerAddress == client.minerAddress && rigID == client.workerName
+	}
+
+	if client.sessionID == "" {
+		err = newStratumError(stratumErrorNotSubscribed)
+	} else if !authorized {
+		err = newStratumError(stratumErrorUnauthorized)
+	} else {
+		err = pool.recieveWorkFromClient(work, client)
+	}
+
+	rejection, err := pool.settleShare(client, err)
 	if err != nil {
-		log.Println(err)
+		return response, err
+	}
+	if rejection != nil {
+		response.Error = rejection
+		return response, nil
 	}
 
 	response.Result = interface{}(true)
 
 	return response, nil
 }
+
+// Bookkeeping for every submitted share, whichever protocol it came in on.
+// Returns the rejection to tell the miner, or an error if they should be dropped.
+func (pool *PoolServer) settleShare(client *stratumClient, shareErr error) (*stratumErrorResponse, error) {
+	if shareErr == nil {
+		recordShareResult(client, true)
+		return nil, nil
+	}
+
+	var stratumError *stratumErrorResponse
+	if !errors.As(shareErr, &stratumError) {
+		log.Println(shareErr)
+		stratumError = newStratumError(stratumErrorOther)
+	}
+
+	// Sessions that never authorized have no worker, their rejects only count toward bans
+	if client.minerAddress != "" {
+		rejects := pool.countRejectedShare(client.minerAddress, client.workerName, stratumError.Code)
+		m := "Rejected share from %v [%v]: %v (%v today)"
+		log.Printf(m, client.ip, client.workerKey(), stratumError.Message, rejects)
+	} else {
+		log.Printf("Rejected share from unauthorized %v: %v", client.ip, stratumError.Message)
+	}
+
+	// Stale shares are expected around new blocks, don't hold them against the miner
+	if stratumError.Code != stratumErrorJobNotFound {
+		recordShareResult(client, false)
+	}
+	if isBanned(client.ip) {
+		return stratumError, errors.New("banned client submitting shares: " + client.ip)
+	}
+
+	return stratumError, nil
+}
+
+const (
+	defaultWorkerName          = "default"
+	defaultMaxWorkerNameLength = 64
+)
+
+var workerNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Login format: primarycoinAddress-auxcoinAddress-auxcoinAddress.rigID, or _rigID.
+// Trailing aux addresses may be left off, see payouts.aux_address_policy.
+// Stratum V2 sends the same thing as its user identity.
+func (pool *PoolServer) parseLogin(loginString, ip string) (string, string, error) {
+	minerAddressesString, rigID, err := pool.splitLogin(loginString)
+	if err != nil {
+		return "", "", errors.New(err.Error() + " from " + ip)
+	}
+
+	minerAddresses := strings.Split(minerAddressesString, "-")
+	if len(minerAddresses) > len(pool.config.BlockChainOrder) {
+		return "", "", errors.New("too many miner addresses to login")
+	}
+
+	// The config has the primarycoinAddress-auxcoinAddress-auxcoinAddress order we need
+	for i, inputBlockChainAddress := range minerAddresses {
+		blockChainName := pool.config.BlockChainOrder[i]
+		if !pool.validAddress(blockChainName, inputBlockChainAddress) {
+			network := pool.activeNodes[blockChainName].Network
+			m := "invalid %v %vnet miner address from %v: %v"
+			m = fmt.Sprintf(m, blockChainName, network, ip, inputBlockChainAddress)
+			return "", "", errors.New(m)
+		}
+	}
+
+	return minerAddressesString, rigID, nil
+}
+
+// Addresses never contain . or _, so the first of either starts the rig ID
+func (pool *PoolServer) splitLogin(loginString string) (string, string, error) {
+	loginString = strings.TrimSpace(loginString)
+	minerAddressesString, rigID := loginString, ""
+	if separator := strings.IndexAny(loginString, "._"); separator >= 0 {
+		minerAddressesString, rigID = loginString[:separator], loginString[separator+1:]
+	}
+
+	if minerAddressesString == "" {
+		return "", "", errors.New("login is missing a miner address")
+	}
+	if rigID == "" {
+		rigID = pool.config.DefaultWorkerName
+	}
+	if len(rigID) > pool.config.MaxWorkerNameLength {
+		return "", "", fmt.Errorf("rig ID over %v characters", pool.config.MaxWorkerNameLength)
+	}
+	if !workerNamePattern.MatchString(rigID) {
+		return "", "", errors.New("rig ID may only have letters, numbers, dots, dashes and underscores")
+	}
+
+	return minerAddressesString, rigID, nil
+}
+
+func (pool *PoolServer) validAddress(blockChainName, address string) bool {
+	network := pool.activeNodes[blockChainName].Network
+	return bitcoin.ValidAddress(bitcoin.GetChain(blockChainName), network, address)
+}
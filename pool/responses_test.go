@@ -0,0 +1,97 @@
+package pool
+
+import (
+	"strings"
+	"testing"
+
+	"designs.capital/dogepool/config"
+)
+
+const (
+	testLitecoinAddress = "LVuDpNCSSj6pQ7t9Pv6d6sUkLKoqDEVUnJ"
+	testDogecoinAddress = "DFpN6QqFfUm3gKNaxN6tNcab1FArL9cZLE"
+)
+
+func testLoginServer() *PoolServer {
+	return &PoolServer{
+		config: &config.Config{
+			BlockChainOrder:     config.BlockChainOrder{"litecoin", "dogecoin"},
+			DefaultWorkerName:   defaultWorkerName,
+			MaxWorkerNameLength: 16,
+		},
+		activeNodes: BlockChainNodesMap{
+			"litecoin": {ChainName: "litecoin", Network: "main"},
+			"dogecoin": {ChainName: "dogecoin", Network: "main"},
+		},
+	}
+}
+
+func TestSplitLogin(t *testing.T) {
+	tests := []struct {
+		login, miner, rig string
+		err               bool
+	}{
+		{login: "L1-D1.rig1", miner: "L1-D1", rig: "rig1"},
+		{login: "L1-D1_rig1", miner: "L1-D1", rig: "rig1"},
+		{login: "L1.rig.1", miner: "L1", rig: "rig.1"},   // Only the first separator splits
+		{login: "L1_rig_1", miner: "L1", rig: "rig_1"},   // Either separator in the rig ID is fine
+		{login: "L1.my-rig", miner: "L1", rig: "my-rig"}, // Dashes only separate addresses before the rig ID
+		{login: "  L1.rig1 ", miner: "L1", rig: "rig1"},
+		{login: "L1", miner: "L1", rig: defaultWorkerName},
+		{login: "L1.", miner: "L1", rig: defaultWorkerName},
+		{login: "L1_", miner: "L1", rig: defaultWorkerName},
+		{login: "L1." + strings.Repeat("a", 16), miner: "L1", rig: strings.Repeat("a", 16)},
+		{login: "L1." + strings.Repeat("a", 17), err: true},
+		{login: "L1.rig 1", err: true},
+		{login: "L1.rig/1", err: true},
+		{login: "L1.rïg", err: true},
+		{login: ".rig1", err: true},
+		{login: "_rig1", err: true},
+		{login: "", err: true},
+	}
+
+	pool := testLoginServer()
+	for _, test := range tests {
+		miner, rig, err := pool.splitLogin(test.login)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v and %v", test.login, miner, rig)
+			}
+			continue
+		}
+		if err != nil || miner != test.miner || rig != test.rig {
+			t.Errorf("%q: %q and %q, %v", test.login, miner, rig, err)
+		}
+	}
+}
+
+// Addresses are checked against merged_blockchain_order, primary first
+func TestParseLogin(t *testing.T) {
+	tests := []struct {
+		login, miner, rig string
+		err               bool
+	}{
+		{login: testLitecoinAddress + "-" + testDogecoinAddress + ".rig1", miner: testLitecoinAddress + "-" + testDogecoinAddress, rig: "rig1"},
+		{login: testLitecoinAddress + "_rig1", miner: testLitecoinAddress, rig: "rig1"}, // Aux address left off
+		{login: testLitecoinAddress, miner: testLitecoinAddress, rig: defaultWorkerName},
+		{login: testDogecoinAddress + "-" + testLitecoinAddress + ".rig1", err: true}, // Wrong order
+		{login: testLitecoinAddress + "-" + testDogecoinAddress + "-" + testDogecoinAddress + ".rig1", err: true},
+		{login: testLitecoinAddress + "-.rig1", err: true},
+		{login: "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r.rig1", err: true}, // Testnet
+		{login: testLitecoinAddress + ".rig 1", err: true},
+	}
+
+	pool := testLoginServer()
+	for _, test := range tests {
+		miner, rig, err := pool.parseLogin(test.login, "127.0.0.1")
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v and %v", test.login, miner, rig)
+			}
+			continue
+		}
+		if err != nil || miner != test.miner || rig != test.rig {
+			t.Errorf("%q: %q and %q, %v", test.login, miner, rig, err)
+		}
+	}
+}
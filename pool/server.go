@@ -1,9 +1,12 @@
 package pool
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
+	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -13,15 +16,35 @@ import (
 	"designs.capital/dogepool/rpc"
 )
 
+// BIP320 general purpose version bits
+const defaultVersionRollingMask = "1fffe000"
+
+const (
+	shutdownDrainTime   = time.Second
+	shutdownGracePeriod = 10 * time.Second
+)
+
 type PoolServer struct {
 	sync.RWMutex
 	config            *config.Config
 	activeNodes       BlockChainNodesMap
 	rpcManagers       map[string]*rpc.Manager
 	connectionTimeout time.Duration
+	writeTimeout      time.Duration
 	templates         Pair
+	jobs              *jobRegistry
 	workCache         bitcoin.Work
 	shareBuffer       []persistence.Share
+	journal           *shareJournal      // Replaces shareBuffer when share_journal_path is set
+	rejectedShares    map[rejectKey]uint // Since rejectedSince, see rejectCountPeriod
+	rejectedSince     time.Time
+	rejectBuffer      map[rejectKey]uint // Since the last flush
+	versionMask       uint32             // BIP310 bits we let miners roll
+	hashrates         *hashrateTracker
+	listeners         []*net.TCPListener
+	sockets           map[net.Conn]bool // Every accepted connection, logged in or not
+	shuttingDown      bool              // Set once, nothing new is listened on or accepted after
+	handlers          sync.WaitGroup    // One per open stratum connection
 }
 
 func NewServer(cfg *config.Config, rpcManagers map[string]*rpc.Manager) *PoolServer {
@@ -34,45 +57,182 @@ func NewServer(cfg *config.Config, rpcManagers map[string]*rpc.Manager) *PoolSer
 	if len(cfg.BlockChainOrder) < 1 {
 		log.Println("Pool must have a blockchain order to tell primary vs aux")
 	}
+	cfg.Ports = cfg.StratumPorts()
+	for i, port := range cfg.Ports {
+		switch port.Protocol {
+		case "":
+			cfg.Ports[i].Protocol = stratumV1
+		case stratumV1:
+		case stratumV2:
+			if port.TLS.Enabled {
+				log.Printf("Port %v is stratum v2, which is already encrypted, disabling TLS", port.Name)
+				cfg.Ports[i].TLS.Enabled = false
+			}
+		default:
+			log.Printf("Port %v has unknown protocol %v, using %v", port.Name, port.Protocol, stratumV1)
+			cfg.Ports[i].Protocol = stratumV1
+		}
+		// A zero difficulty has no target, every share from the port would panic weighing it
+		if port.Difficulty <= 0 {
+			if cfg.PoolDifficulty <= 0 {
+				log.Fatalf("Port %v needs a difficulty above 0, or pool_difficulty to fall back on", port.Name)
+			}
+			log.Printf("Port %v must have a difficulty above 0, using pool_difficulty %v", port.Name, cfg.PoolDifficulty)
+			cfg.Ports[i].Difficulty = cfg.PoolDifficulty
+		}
+		vardiff := port.Vardiff
+		if vardiff.Enabled && (vardiff.MinDifficulty <= 0 || vardiff.MaxDifficulty < vardiff.MinDifficulty) {
+			log.Printf("Port %v vardiff needs a min_difficulty above 0 and a max_difficulty above that, disabling vardiff", port.Name)
+			cfg.Ports[i].Vardiff.Enabled = false
+		}
+	}
+
+	if cfg.WriteTimeout == "" {
+		cfg.WriteTimeout = defaultWriteTimeout
+	}
+	if cfg.SendQueueSize < 1 {
+		cfg.SendQueueSize = defaultSendQueueSize
+	}
+	if !workerNamePattern.MatchString(cfg.DefaultWorkerName) {
+		if cfg.DefaultWorkerName != "" {
+			log.Printf("Invalid default_worker_name %q, using %v", cfg.DefaultWorkerName, defaultWorkerName)
+		}
+		cfg.DefaultWorkerName = defaultWorkerName
+	}
+	if cfg.MaxWorkerNameLength < 1 {
+		cfg.MaxWorkerNameLength = defaultMaxWorkerNameLength
+	}
+	if cfg.HashrateWindow == "" {
+		cfg.HashrateWindow = defaultHashrateWindow
+	}
+
+	if cfg.VersionRollingMask == "" {
+		cfg.VersionRollingMask = defaultVersionRollingMask
+	}
+	versionMask, err := strconv.ParseUint(cfg.VersionRollingMask, 16, 32)
+	if err != nil {
+		log.Println("Invalid version_rolling_mask, version rolling disabled: " + err.Error())
+		versionMask = 0
+	}
 
 	pool := &PoolServer{
-		config:      cfg,
-		rpcManagers: rpcManagers,
+		config:         cfg,
+		rpcManagers:    rpcManagers,
+		jobs:           newJobRegistry(),
+		rejectedShares: make(map[rejectKey]uint),
+		rejectedSince:  time.Now(),
+		rejectBuffer:   make(map[rejectKey]uint),
+		sockets:        make(map[net.Conn]bool),
+		versionMask:    uint32(versionMask),
+		hashrates:      newHashrateTracker(mustParseDuration(cfg.HashrateWindow), bitcoin.HashesPerDifficulty(bitcoin.GetChain(cfg.GetPrimary()))),
 	}
 
 	return pool
 }
 
-func (pool *PoolServer) Start() {
+func (pool *PoolServer) Start(ctx context.Context) {
 	initiateSessions()
+	initiatePolicy(pool.config.PoolName, pool.config.BanPolicy)
 	pool.loadBlockchainNodes()
-	pool.startBufferManager()
-
-	amountOfChains := len(pool.config.BlockChainOrder) - 1
-	pool.templates.AuxBlocks = make([]bitcoin.AuxBlock, amountOfChains)
+	panicOnError(pool.startBufferManager(ctx))
+	go pool.hashrates.pruneOnInterval(pool.hashrates.window)
 
 	// Initial work creation
 	panicOnError(pool.fetchRpcBlockTemplatesAndCacheWork())
 	work, err := pool.generateWorkFromCache(false)
 	panicOnError(err)
 
-	go pool.listenForConnections()
+	pool.listenForConnections()
 	pool.broadcastWork(work)
 
 	// There after..
-	panicOnError(pool.listenForBlockNotifications())
+	panicOnError(pool.listenForBlockNotifications(ctx))
+}
+
+// Stops taking miners, asks the connected ones to come back later,
+// and writes out every share we've acknowledged before returning.
+func (pool *PoolServer) Shutdown() {
+	pool.Lock()
+	pool.shuttingDown = true
+	listeners := pool.listeners
+	pool.listeners = nil
+	pool.Unlock()
+
+	for _, listener := range listeners {
+		logOnError(listener.Close())
+	}
+
+	clients := allSessions()
+	logOnError(broadcastPacket(clientReconnect("", "", 0), clients))
+	v2Clients := allV2Connections()
+	for _, connection := range v2Clients {
+		logOnError(connection.reconnect("", 0))
+	}
+	log.Printf("Asked %v client(s) to reconnect", len(clients)+len(v2Clients))
+
+	// Give writers a moment to get the reconnect out, then cut everyone off,
+	// including connections still handshaking or that never logged in
+	time.Sleep(shutdownDrainTime)
+	for _, socket := range pool.openSockets() {
+		socket.Close()
+	}
+
+	// Shares already being validated still land in the buffer
+	handlersDone := make(chan struct{})
+	go func() {
+		pool.handlers.Wait()
+		close(handlersDone)
+	}()
+	select {
+	case <-handlersDone:
+	case <-time.After(shutdownGracePeriod):
+		log.Println("Timed out waiting for stratum connections to close")
+	}
+
+	err := pool.flushShareBuffer()
+	if err != nil {
+		log.Println("Failed to flush shares on shutdown: " + err.Error())
+	}
+
+	if pool.journal != nil {
+		logOnError(pool.journal.close())
+	}
 }
 
 func (pool *PoolServer) broadcastWork(work bitcoin.Work) {
 	request := miningNotify(work)
 	err := notifyAllSessions(request)
 	logOnError(err)
+	notifyV2Channels(work)
+}
+
+func (client *stratumClient) setDifficulty(pool *PoolServer, difficulty float64) error {
+	if client.channel != nil {
+		return client.channel.sendTarget(difficulty)
+	}
+	return pool.sendDifficulty(client, difficulty)
+}
+
+// Miners only apply a new difficulty to the work that follows it
+func (pool *PoolServer) sendDifficulty(client *stratumClient, difficulty float64) error {
+	err := sendPacket(miningSetDifficulty(difficulty), client)
+	if err != nil {
+		return err
+	}
+
+	work, err := pool.generateWorkFromCache(false)
+	if err != nil {
+		return err
+	}
+
+	return sendPacket(miningNotify(work), client)
 }
 
-func (p *PoolServer) fetchAllBlockTemplatesFromRPC() (bitcoin.Template, *bitcoin.AuxBlock, error) {
+func (p *PoolServer) fetchAllBlockTemplatesFromRPC() (bitcoin.Template, []bitcoin.AuxBlock, error) {
 	var template bitcoin.Template
 	var err error
-	response, err := p.GetPrimaryNode().RPC.GetBlockTemplate()
+	rules := bitcoin.GetChain(p.config.GetPrimary()).BlockTemplateRules()
+	response, err := p.GetPrimaryNode().RPC.GetBlockTemplateWithRules(rules)
 	if err != nil {
 		return template, nil, errors.New("RPC error: " + err.Error())
 	}
@@ -82,30 +242,50 @@ func (p *PoolServer) fetchAllBlockTemplatesFromRPC() (bitcoin.Template, *bitcoin
 		return template, nil, err
 	}
 
-	var auxBlock bitcoin.AuxBlock
-
-	if p.config.GetAux1() != "" {
-		response, err = p.GetAux1Node().RPC.CreateAuxBlock(p.GetAux1Node().RewardTo)
+	// One aux chain being down shouldn't stop us merge mining the rest
+	var auxBlocks []bitcoin.AuxBlock
+	for _, auxChainName := range p.config.BlockChainOrder[1:] {
+		node := p.activeNodes[auxChainName]
+		response, err = node.RPC.CreateAuxBlock(node.RewardTo)
 		if err != nil {
-			log.Println("No aux block found: " + err.Error())
-			return template, nil, nil
+			log.Printf("No %v aux block found: %v", auxChainName, err)
+			continue
 		}
 
+		var auxBlock bitcoin.AuxBlock
 		err = json.Unmarshal(response, &auxBlock)
 		if err != nil {
 			return template, nil, err
 		}
+		auxBlock.ChainName = auxChainName
+		if auxBlock.ChainID == 0 {
+			auxBlock.ChainID = bitcoin.GetChain(auxChainName).AuxChainID()
+		}
+
+		auxBlocks = append(auxBlocks, auxBlock)
 	}
 
-	return template, &auxBlock, nil
+	return template, auxBlocks, nil
 }
 
+// Retarget here too so difficulty changes land before the new job
 func notifyAllSessions(request stratumRequest) error {
-	for _, client := range sessions {
-		err := sendPacket(request, client)
-		logOnError(err)
+	now := time.Now()
+	clients := allSessions()
+	for _, client := range clients {
+		client.vardiff.clearPrevious()
+		newDifficulty, retargeted := client.vardiff.retarget(now)
+		if retargeted {
+			err := sendPacket(miningSetDifficulty(newDifficulty), client)
+			logOnError(err)
+		}
+	}
+
+	err := broadcastPacket(request, clients)
+	if err != nil {
+		return err
 	}
-	log.Printf("Sent work to %v client(s)", len(sessions))
+	log.Printf("Queued work for %v client(s)", len(clients))
 	return nil
 }
 
@@ -1,17 +1,127 @@
 package pool
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 type sessionMap map[string]*stratumClient
 
-var sessions sessionMap
+// The miner and worker a session is indexed under.  The client's own fields belong to its
+// connection goroutine, and a re-authorize has already changed them by the time it's re-indexed
+type sessionEntry struct {
+	client       *stratumClient
+	minerAddress string
+	workerName   string
+}
+
+type sessionManager struct {
+	sync.RWMutex
+	byID     map[string]sessionEntry
+	byMiner  map[string]sessionMap // miner address => sessions
+	byWorker map[string]sessionMap // "miner.worker" => sessions
+}
+
+var sessions *sessionManager
+
+// Open sockets, authorized or not
+var numberOfConnections atomic.Int64
 
 func initiateSessions() {
-	sessions = make(sessionMap)
+	sessions = &sessionManager{
+		byID:     make(map[string]sessionEntry),
+		byMiner:  make(map[string]sessionMap),
+		byWorker: make(map[string]sessionMap),
+	}
 }
 
-func addSession(client *stratumClient) {
-	sessions[client.sessionID] = client
+func addSession(client *stratumClient, minerAddress, workerName string) {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	// Re-authorizing can change the miner and worker we're indexed under
+	sessions.removeLocked(client.sessionID)
+
+	sessions.byID[client.sessionID] = sessionEntry{
+		client:       client,
+		minerAddress: minerAddress,
+		workerName:   workerName,
+	}
+	addToIndex(sessions.byMiner, minerAddress, client)
+	addToIndex(sessions.byWorker, minerAddress+"."+workerName, client)
 }
 
 func removeSession(sessionID string) {
-	delete(sessions, sessionID)
+	sessions.Lock()
+	defer sessions.Unlock()
+	sessions.removeLocked(sessionID)
+}
+
+func (m *sessionManager) removeLocked(sessionID string) {
+	entry, exists := m.byID[sessionID]
+	if !exists {
+		return
+	}
+
+	delete(m.byID, sessionID)
+	removeFromIndex(m.byMiner, entry.minerAddress, sessionID)
+	removeFromIndex(m.byWorker, entry.minerAddress+"."+entry.workerName, sessionID)
+}
+
+func getSession(sessionID string) (*stratumClient, bool) {
+	sessions.RLock()
+	defer sessions.RUnlock()
+	entry, exists := sessions.byID[sessionID]
+	return entry.client, exists
+}
+
+func sessionsByMiner(minerAddress string) []*stratumClient {
+	sessions.RLock()
+	defer sessions.RUnlock()
+	return sessions.byMiner[minerAddress].list()
+}
+
+func sessionsByWorker(minerAddress, workerName string) []*stratumClient {
+	sessions.RLock()
+	defer sessions.RUnlock()
+	return sessions.byWorker[minerAddress+"."+workerName].list()
+}
+
+// A snapshot, so callers can write to clients without holding the lock
+func allSessions() []*stratumClient {
+	sessions.RLock()
+	defer sessions.RUnlock()
+	clients := make([]*stratumClient, 0, len(sessions.byID))
+	for _, entry := range sessions.byID {
+		clients = append(clients, entry.client)
+	}
+	return clients
+}
+
+func (m sessionMap) list() []*stratumClient {
+	clients := make([]*stratumClient, 0, len(m))
+	for _, client := range m {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func addToIndex(index map[string]sessionMap, key string, client *stratumClient) {
+	indexed, exists := index[key]
+	if !exists {
+		indexed = make(sessionMap)
+		index[key] = indexed
+	}
+	indexed[client.sessionID] = client
+}
+
+func removeFromIndex(index map[string]sessionMap, key, sessionID string) {
+	indexed, exists := index[key]
+	if !exists {
+		return
+	}
+	delete(indexed, sessionID)
+	if len(indexed) == 0 {
+		delete(index, key)
+	}
 }
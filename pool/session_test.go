@@ -0,0 +1,27 @@
+package pool
+
+import "testing"
+
+// The client's fields already hold the new login when it's re-indexed
+func TestReauthorizeMovesSessionIndex(t *testing.T) {
+	initiateSessions()
+	client := &stratumClient{sessionID: "1", minerAddress: "Lnew", workerName: "rig2"}
+
+	addSession(client, "Lold", "rig1")
+	addSession(client, "Lnew", "rig2")
+
+	if found := sessionsByMiner("Lold"); len(found) != 0 {
+		t.Errorf("%v session(s) left under the old miner", len(found))
+	}
+	if found := sessionsByWorker("Lold", "rig1"); len(found) != 0 {
+		t.Errorf("%v session(s) left under the old worker", len(found))
+	}
+	if found := sessionsByWorker("Lnew", "rig2"); len(found) != 1 || found[0] != client {
+		t.Errorf("new worker has %v session(s)", len(found))
+	}
+
+	removeSession("1")
+	if len(allSessions()) != 0 || len(sessionsByMiner("Lnew")) != 0 {
+		t.Error("session left in the index after removal")
+	}
+}
@@ -1,6 +1,8 @@
 package pool
 
 import (
+	"math/big"
+
 	"designs.capital/dogepool/bitcoin"
 )
 
@@ -8,53 +10,77 @@ const (
 	shareInvalid = iota
 	shareValid
 	primaryCandidate
-	aux1Candidate
+	auxCandidate
 	dualCandidate
 )
 
 var statusMap = map[int]string{
 	2: "Primary",
-	3: "Aux1",
+	3: "Aux",
 	4: "Dual",
 }
 
-func validateAndWeighShare(primary *bitcoin.BitcoinBlock, aux1 *bitcoin.AuxBlock, poolDifficulty float64) (int, float64) {
+// Also returns which aux blocks, by index, the share meets the target of
+func validateAndWeighShare(primary *bitcoin.BitcoinBlock, auxBlocks []bitcoin.AuxBlock, poolDifficulty float64) (int, []int, float64) {
 	primarySum, err := primary.Sum()
 	logOnError(err)
 
-	primaryTarget := bitcoin.Target(primary.Template.Target)
-	primaryTargetBig, _ := primaryTarget.ToBig()
-
 	poolTarget, _ := bitcoin.TargetFromDifficulty(poolDifficulty / primary.ShareMultiplier())
 	shareDifficulty, _ := poolTarget.ToDifficulty()
 
 	status := shareInvalid
 
-	if primarySum.Cmp(primaryTargetBig) <= 0 {
+	primaryTarget, valid := blockTarget(primary.Template.Bits)
+	if valid && primarySum.Cmp(primaryTarget) <= 0 {
 		status = primaryCandidate
 	}
 
-	if aux1.Hash != "" {
-		auxTarget := bitcoin.Target(reverseHexBytes(aux1.Target))
-		auxTargetBig, _ := auxTarget.ToBig()
-
-		if primarySum.Cmp(auxTargetBig) <= 0 {
-			if status == primaryCandidate {
-				status = dualCandidate
-			} else {
-				status = aux1Candidate
-			}
+	var auxCandidates []int
+	for i, auxBlock := range auxBlocks {
+		auxTarget, valid := blockTarget(auxBlock.Bits)
+		if valid && primarySum.Cmp(auxTarget) <= 0 {
+			auxCandidates = append(auxCandidates, i)
+		}
+	}
+	if len(auxCandidates) > 0 {
+		if status == primaryCandidate {
+			status = dualCandidate
+		} else {
+			status = auxCandidate
 		}
 	}
 
 	if status > shareInvalid {
-		return status, shareDifficulty
+		return status, auxCandidates, shareDifficulty
 	}
 
 	poolTargettBig, _ := poolTarget.ToBig()
 	if primarySum.Cmp(poolTargettBig) <= 0 {
-		return shareValid, shareDifficulty
+		return shareValid, nil, shareDifficulty
 	}
 
-	return shareInvalid, shareDifficulty
+	return shareInvalid, nil, shareDifficulty
+}
+
+// What's left of a block candidate once stale chains are dropped
+func candidateStatus(primary, aux bool) int {
+	switch {
+	case primary && aux:
+		return dualCandidate
+	case primary:
+		return primaryCandidate
+	case aux:
+		return auxCandidate
+	}
+	return shareValid
+}
+
+// Primary and aux targets both come from their block's compact bits
+func blockTarget(bits string) (*big.Int, bool) {
+	target, err := bitcoin.TargetFromBits(bits)
+	if err != nil {
+		logOnError(err)
+		return nil, false
+	}
+	return target.ToBig()
 }
@@ -0,0 +1,270 @@
+package pool
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// https://github.com/stratum-mining/sv2-spec/blob/main/05-Mining-Protocol.md
+
+const (
+	v2ProtocolVersion = 2
+	v2MiningProtocol  = 0
+	v2ChannelBit      = 0x8000 // Set in extension_type on channel specific messages
+	v2HeaderLength    = 6
+)
+
+// Common and mining message types
+const (
+	v2SetupConnection            = 0x00
+	v2SetupConnectionSuccess     = 0x01
+	v2SetupConnectionError       = 0x02
+	v2OpenStandardMiningChannel  = 0x10
+	v2OpenStandardChannelSuccess = 0x11
+	v2OpenMiningChannelError     = 0x12
+	v2OpenExtendedMiningChannel  = 0x13
+	v2NewMiningJob               = 0x15
+	v2UpdateChannel              = 0x16
+	v2UpdateChannelError         = 0x17
+	v2CloseChannel               = 0x18
+	v2SubmitSharesStandard       = 0x1a
+	v2SubmitSharesExtended       = 0x1b
+	v2SubmitSharesSuccess        = 0x1c
+	v2SubmitSharesError          = 0x1d
+	v2SetNewPrevHash             = 0x20
+	v2SetTarget                  = 0x21
+	v2Reconnect                  = 0x25
+)
+
+// SetupConnection flags for the mining protocol
+const (
+	v2RequiresStandardJobs   = 1 << 0
+	v2RequiresWorkSelection  = 1 << 1
+	v2RequiresVersionRolling = 1 << 2
+)
+
+// SetupConnection.Success flags
+const v2RequiresFixedVersion = 1 << 0
+
+var v2ChannelMessages = map[uint8]bool{
+	v2NewMiningJob:         true,
+	v2UpdateChannel:        true,
+	v2UpdateChannelError:   true,
+	v2CloseChannel:         true,
+	v2SubmitSharesStandard: true,
+	v2SubmitSharesExtended: true,
+	v2SubmitSharesSuccess:  true,
+	v2SubmitSharesError:    true,
+	v2SetNewPrevHash:       true,
+	v2SetTarget:            true,
+}
+
+type v2Frame struct {
+	messageType uint8
+	payload     []byte
+}
+
+// Little endian writer for the SV2 binary types
+type v2Encoder struct {
+	buffer []byte
+}
+
+func (e *v2Encoder) u8(value uint8) *v2Encoder {
+	e.buffer = append(e.buffer, value)
+	return e
+}
+
+func (e *v2Encoder) u16(value uint16) *v2Encoder {
+	e.buffer = binary.LittleEndian.AppendUint16(e.buffer, value)
+	return e
+}
+
+func (e *v2Encoder) u32(value uint32) *v2Encoder {
+	e.buffer = binary.LittleEndian.AppendUint32(e.buffer, value)
+	return e
+}
+
+func (e *v2Encoder) u64(value uint64) *v2Encoder {
+	e.buffer = binary.LittleEndian.AppendUint64(e.buffer, value)
+	return e
+}
+
+// U256, already little endian
+func (e *v2Encoder) u256(value []byte) *v2Encoder {
+	padded := make([]byte, 32)
+	copy(padded, value)
+	e.buffer = append(e.buffer, padded...)
+	return e
+}
+
+// STR0_255 and B0_32 share a one byte length prefix
+func (e *v2Encoder) bytes255(value []byte) *v2Encoder {
+	if len(value) > math.MaxUint8 {
+		value = value[:math.MaxUint8]
+	}
+	e.buffer = append(e.buffer, uint8(len(value)))
+	e.buffer = append(e.buffer, value...)
+	return e
+}
+
+func (e *v2Encoder) str(value string) *v2Encoder {
+	return e.bytes255([]byte(value))
+}
+
+// OPTION[u32], nil is None
+func (e *v2Encoder) optionalU32(value *uint32) *v2Encoder {
+	if value == nil {
+		return e.u8(0)
+	}
+	return e.u8(1).u32(*value)
+}
+
+type v2Decoder struct {
+	buffer []byte
+	err    error
+}
+
+var errV2ShortMessage = errors.New("stratum v2 message too short")
+
+func (d *v2Decoder) take(length int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buffer) < length {
+		d.err = errV2ShortMessage
+		return nil
+	}
+	value := d.buffer[:length]
+	d.buffer = d.buffer[length:]
+	return value
+}
+
+func (d *v2Decoder) u8() uint8 {
+	value := d.take(1)
+	if value == nil {
+		return 0
+	}
+	return value[0]
+}
+
+func (d *v2Decoder) u16() uint16 {
+	value := d.take(2)
+	if value == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(value)
+}
+
+func (d *v2Decoder) u32() uint32 {
+	value := d.take(4)
+	if value == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(value)
+}
+
+func (d *v2Decoder) f32() float32 {
+	return math.Float32frombits(d.u32())
+}
+
+func (d *v2Decoder) u256() []byte {
+	return d.take(32)
+}
+
+func (d *v2Decoder) str() string {
+	return string(d.take(int(d.u8())))
+}
+
+type v2SetupConnectionMessage struct {
+	protocol        uint8
+	minVersion      uint16
+	maxVersion      uint16
+	flags           uint32
+	endpointHost    string
+	endpointPort    uint16
+	vendor          string
+	hardwareVersion string
+	firmware        string
+	deviceID        string
+}
+
+func decodeV2SetupConnection(payload []byte) (v2SetupConnectionMessage, error) {
+	d := &v2Decoder{buffer: payload}
+	message := v2SetupConnectionMessage{
+		protocol:        d.u8(),
+		minVersion:      d.u16(),
+		maxVersion:      d.u16(),
+		flags:           d.u32(),
+		endpointHost:    d.str(),
+		endpointPort:    d.u16(),
+		vendor:          d.str(),
+		hardwareVersion: d.str(),
+		firmware:        d.str(),
+		deviceID:        d.str(),
+	}
+	return message, d.err
+}
+
+type v2OpenStandardChannelMessage struct {
+	requestID       uint32
+	userIdentity    string
+	nominalHashRate float32
+	maxTarget       []byte
+}
+
+func decodeV2OpenStandardChannel(payload []byte) (v2OpenStandardChannelMessage, error) {
+	d := &v2Decoder{buffer: payload}
+	message := v2OpenStandardChannelMessage{
+		requestID:       d.u32(),
+		userIdentity:    d.str(),
+		nominalHashRate: d.f32(),
+		maxTarget:       d.u256(),
+	}
+	return message, d.err
+}
+
+type v2UpdateChannelMessage struct {
+	channelID       uint32
+	nominalHashRate float32
+	maxTarget       []byte
+}
+
+func decodeV2UpdateChannel(payload []byte) (v2UpdateChannelMessage, error) {
+	d := &v2Decoder{buffer: payload}
+	message := v2UpdateChannelMessage{
+		channelID:       d.u32(),
+		nominalHashRate: d.f32(),
+		maxTarget:       d.u256(),
+	}
+	return message, d.err
+}
+
+type v2SubmitSharesStandardMessage struct {
+	channelID      uint32
+	sequenceNumber uint32
+	jobID          uint32
+	nonce          uint32
+	nonceTime      uint32
+	version        uint32
+}
+
+func decodeV2SubmitSharesStandard(payload []byte) (v2SubmitSharesStandardMessage, error) {
+	d := &v2Decoder{buffer: payload}
+	message := v2SubmitSharesStandardMessage{
+		channelID:      d.u32(),
+		sequenceNumber: d.u32(),
+		jobID:          d.u32(),
+		nonce:          d.u32(),
+		nonceTime:      d.u32(),
+		version:        d.u32(),
+	}
+	return message, d.err
+}
+
+// Both the first field of OpenExtendedMiningChannel and CloseChannel
+func decodeV2LeadingU32(payload []byte) (uint32, error) {
+	d := &v2Decoder{buffer: payload}
+	value := d.u32()
+	return value, d.err
+}
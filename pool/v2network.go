@@ -0,0 +1,648 @@
+package pool
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"designs.capital/dogepool/bitcoin"
+	"designs.capital/dogepool/config"
+	"github.com/google/uuid"
+)
+
+const defaultCertificateValidity = "8760h"
+
+// Every channel's extranonce is its extranonce1 with a fixed, zeroed extranonce2
+const v2Extranonce2 = "00000000"
+
+// A proxy multiplexes its miners as channels, past this it should open another connection
+const maxV2ChannelsPerConnection = 256
+
+// One Noise encrypted socket, possibly carrying many standard channels (I.e. a proxy)
+type v2Connection struct {
+	sync.Mutex     // Guards channels and keeps encryption in send order
+	pool           *PoolServer
+	client         *stratumClient // The socket, its outbound queue and writer
+	receive        *noiseCipher
+	send           *noiseCipher
+	setup          bool
+	versionRolling bool
+	userAgent      string
+	channels       map[uint32]*v2Channel
+	nextChannelID  uint32
+}
+
+type v2Channel struct {
+	sync.Mutex
+	id         uint32
+	connection *v2Connection
+	session    *stratumClient // Identity, extranonce and vardiff for share processing
+	prevHash   string         // Last SetNewPrevHash, so we know when jobs need a new one
+	counted    bool           // Holds a max_connections slot of its own, see reserveChannelSlot
+}
+
+type v2ConnectionRegistry struct {
+	sync.RWMutex
+	connections map[*v2Connection]bool
+}
+
+var v2Connections = &v2ConnectionRegistry{
+	connections: make(map[*v2Connection]bool),
+}
+
+func addV2Connection(connection *v2Connection) {
+	v2Connections.Lock()
+	v2Connections.connections[connection] = true
+	v2Connections.Unlock()
+}
+
+func removeV2Connection(connection *v2Connection) {
+	v2Connections.Lock()
+	delete(v2Connections.connections, connection)
+	v2Connections.Unlock()
+}
+
+func allV2Connections() []*v2Connection {
+	v2Connections.RLock()
+	defer v2Connections.RUnlock()
+
+	connections := make([]*v2Connection, 0, len(v2Connections.connections))
+	for connection := range v2Connections.connections {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+// Connections with at least one channel matches is true for
+func v2ConnectionsWith(matches func(session *stratumClient) bool) []*v2Connection {
+	var matching []*v2Connection
+	for _, connection := range allV2Connections() {
+		for _, channel := range connection.allChannels() {
+			if matches(channel.session) {
+				matching = append(matching, connection)
+				break
+			}
+		}
+	}
+	return matching
+}
+
+func loadNoiseIdentity(noiseConfig config.NoiseConfig) (*noiseIdentity, error) {
+	var authoritySecret []byte
+	var err error
+	if noiseConfig.AuthoritySecretKey == "" {
+		log.Println("No noise authority_secret_key set, using a random one miners can't pin across restarts")
+		authoritySecret, err = bitcoin.NewSecretKey(rand.Reader)
+	} else {
+		authoritySecret, err = hex.DecodeString(noiseConfig.AuthoritySecretKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	validity := noiseConfig.CertificateValidity
+	if validity == "" {
+		validity = defaultCertificateValidity
+	}
+	now := time.Now()
+	validFrom := uint32(now.Add(-time.Hour).Unix()) // Some slack for miners with slow clocks
+	notValidAfter := uint32(now.Add(mustParseDuration(validity)).Unix())
+
+	identity, err := newNoiseIdentity(authoritySecret, validFrom, notValidAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Stratum V2 authority public key: %x", identity.authorityXKey)
+	return identity, nil
+}
+
+func (pool *PoolServer) handleV2Connection(client *stratumClient) error {
+	client.connection.SetReadDeadline(time.Now().Add(pool.connectionTimeout))
+
+	receive, send, err := client.port.noise.respond(client.connection)
+	if err != nil {
+		return errors.New("stratum v2 handshake failed with " + client.ip + ": " + err.Error())
+	}
+
+	connection := &v2Connection{
+		pool:     pool,
+		client:   client,
+		receive:  receive,
+		send:     send,
+		channels: make(map[uint32]*v2Channel),
+	}
+	addV2Connection(connection)
+	defer connection.close()
+
+	reader := bufio.NewReader(client.connection)
+	for {
+		frame, err := connection.readFrame(reader)
+		if err == io.EOF {
+			return errors.New("client disconnect: " + client.ip)
+		} else if err != nil {
+			return err
+		}
+
+		client.connection.SetReadDeadline(time.Now().Add(pool.connectionTimeout))
+
+		err = connection.handle(frame)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Decrypts the 6 byte header, then the payload in Noise sized chunks
+func (connection *v2Connection) readFrame(reader io.Reader) (v2Frame, error) {
+	var frame v2Frame
+
+	encryptedHeader := make([]byte, v2HeaderLength+noiseMACLength)
+	_, err := io.ReadFull(reader, encryptedHeader)
+	if err != nil {
+		return frame, err
+	}
+	header, err := connection.receive.decrypt(nil, encryptedHeader)
+	if err != nil {
+		return frame, err
+	}
+
+	frame.messageType = header[2]
+	length := int(header[3]) | int(header[4])<<8 | int(header[5])<<16
+	if length > noiseMaxPlaintext {
+		markMalformedRequest(connection.client, nil)
+		return frame, fmt.Errorf("stratum v2 message of %v bytes from %v", length, connection.client.ip)
+	}
+
+	if length > 0 {
+		encryptedPayload := make([]byte, length+noiseMACLength)
+		_, err = io.ReadFull(reader, encryptedPayload)
+		if err != nil {
+			return frame, err
+		}
+		frame.payload, err = connection.receive.decrypt(nil, encryptedPayload)
+		if err != nil {
+			return frame, err
+		}
+	}
+
+	return frame, nil
+}
+
+func (connection *v2Connection) sendFrame(messageType uint8, payload *v2Encoder) error {
+	extensionType := uint16(0)
+	if v2ChannelMessages[messageType] {
+		extensionType |= v2ChannelBit
+	}
+
+	length := len(payload.buffer)
+	header := binary.LittleEndian.AppendUint16(nil, extensionType)
+	header = append(header, messageType, uint8(length), uint8(length>>8), uint8(length>>16))
+
+	connection.Lock()
+	defer connection.Unlock()
+
+	data, err := connection.send.encrypt(nil, header)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < length; start += noiseMaxPlaintext {
+		end := min(start+noiseMaxPlaintext, length)
+		chunk, err := connection.send.encrypt(nil, payload.buffer[start:end])
+		if err != nil {
+			return err
+		}
+		data = append(data, chunk...)
+	}
+
+	return connection.client.enqueue(outboundPacket{data: data})
+}
+
+func (connection *v2Connection) handle(frame v2Frame) error {
+	if !connection.setup && frame.messageType != v2SetupConnection {
+		markMalformedRequest(connection.client, frame.payload)
+		return errors.New("stratum v2 message before SetupConnection from " + connection.client.ip)
+	}
+
+	switch frame.messageType {
+	case v2SetupConnection:
+		return connection.setupConnection(frame.payload)
+	case v2OpenStandardMiningChannel:
+		return connection.openStandardChannel(frame.payload)
+	case v2OpenExtendedMiningChannel:
+		requestID, err := decodeV2LeadingU32(frame.payload)
+		if err != nil {
+			return err
+		}
+		return connection.sendFrame(v2OpenMiningChannelError, new(v2Encoder).u32(requestID).str("unsupported-channel-type"))
+	case v2UpdateChannel:
+		return connection.updateChannel(frame.payload)
+	case v2CloseChannel:
+		channelID, err := decodeV2LeadingU32(frame.payload)
+		if err != nil {
+			return err
+		}
+		connection.closeChannel(channelID)
+		return nil
+	case v2SubmitSharesStandard:
+		return connection.submitShares(frame.payload)
+	default:
+		log.Printf("Ignoring stratum v2 message type %#x from %v", frame.messageType, connection.client.ip)
+		return nil
+	}
+}
+
+func (connection *v2Connection) setupConnection(payload []byte) error {
+	if connection.setup {
+		return errors.New("repeated SetupConnection from " + connection.client.ip)
+	}
+
+	setup, err := decodeV2SetupConnection(payload)
+	if err != nil {
+		markMalformedRequest(connection.client, payload)
+		return err
+	}
+
+	// The miner closes the connection after an error, nothing else is accepted until then
+	errorCode := ""
+	if setup.protocol != v2MiningProtocol {
+		errorCode = "unsupported-protocol"
+	} else if setup.minVersion > v2ProtocolVersion || setup.maxVersion < v2ProtocolVersion {
+		errorCode = "protocol-version-mismatch"
+	} else if setup.flags&v2RequiresWorkSelection != 0 ||
+		(setup.flags&v2RequiresVersionRolling != 0 && connection.pool.versionMask == 0) {
+		errorCode = "unsupported-feature-flags"
+	}
+	if errorCode != "" {
+		unsupported := setup.flags & (v2RequiresWorkSelection | v2RequiresVersionRolling)
+		return connection.sendFrame(v2SetupConnectionError, new(v2Encoder).u32(unsupported).str(errorCode))
+	}
+
+	connection.setup = true
+	connection.versionRolling = connection.pool.versionMask != 0
+	connection.userAgent = setup.vendor + "/" + setup.firmware
+
+	log.Printf("New stratum v2 connection from %v [%v %v]", connection.client.ip, setup.vendor, setup.hardwareVersion)
+
+	flags := uint32(0)
+	if !connection.versionRolling {
+		flags |= v2RequiresFixedVersion
+	}
+	return connection.sendFrame(v2SetupConnectionSuccess, new(v2Encoder).u16(v2ProtocolVersion).u32(flags))
+}
+
+func (connection *v2Connection) openStandardChannel(payload []byte) error {
+	request, err := decodeV2OpenStandardChannel(payload)
+	if err != nil {
+		markMalformedRequest(connection.client, payload)
+		return err
+	}
+
+	client := connection.client
+	pool := connection.pool
+
+	minerAddress, rigID, err := pool.parseLogin(request.userIdentity, client.ip)
+	if err != nil {
+		log.Println(err)
+		return connection.sendFrame(v2OpenMiningChannelError, new(v2Encoder).u32(request.requestID).str("unknown-user"))
+	}
+
+	session := &stratumClient{
+		ip:           client.ip,
+		login:        request.userIdentity,
+		minerAddress: minerAddress,
+		workerName:   rigID,
+		extranonce1:  uniqueExtranonce(extranonce1Length * 2),
+		userAgent:    connection.userAgent,
+		sessionID:    uuid.NewString(),
+		connection:   client.connection,
+		outbound:     client.outbound,
+		done:         client.done,
+		port:         client.port,
+		vardiff:      newVardiff(client.port.config.Vardiff, client.port.config.Difficulty),
+	}
+	if connection.versionRolling {
+		session.versionRollingMask = pool.versionMask
+	}
+
+	connection.Lock()
+	// The socket already counts as one connection, that covers its first channel
+	counted := len(connection.channels) > 0
+	if len(connection.channels) >= maxV2ChannelsPerConnection || (counted && !pool.reserveChannelSlot(client.port)) {
+		connection.Unlock()
+		log.Printf("Too many stratum v2 channels from %v, rejecting rig: %v", client.ip, rigID)
+		return connection.sendFrame(v2OpenMiningChannelError, new(v2Encoder).u32(request.requestID).str("too-many-channels"))
+	}
+	connection.nextChannelID++
+	channel := &v2Channel{
+		id:         connection.nextChannelID,
+		connection: connection,
+		session:    session,
+		counted:    counted,
+	}
+	connection.channels[channel.id] = channel
+	connection.Unlock()
+	session.channel = channel
+
+	channel.applyMaxTarget(request.maxTarget)
+
+	extranoncePrefix, err := hex.DecodeString(session.getExtranonce1() + v2Extranonce2)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Opened stratum v2 channel %v for rig: %v mining to addresses: %v", channel.id, rigID, minerAddress)
+
+	success := new(v2Encoder).
+		u32(request.requestID).
+		u32(channel.id).
+		u256(channel.target(session.vardiff.difficulty())).
+		bytes255(extranoncePrefix).
+		u32(0) // Not in a group channel
+	err = connection.sendFrame(v2OpenStandardChannelSuccess, success)
+	if err != nil {
+		return err
+	}
+
+	work, err := pool.generateWorkFromCache(false)
+	if err != nil {
+		return err
+	}
+	return channel.sendJob(work)
+}
+
+func (connection *v2Connection) updateChannel(payload []byte) error {
+	update, err := decodeV2UpdateChannel(payload)
+	if err != nil {
+		markMalformedRequest(connection.client, payload)
+		return err
+	}
+
+	channel, exists := connection.channel(update.channelID)
+	if !exists {
+		return connection.sendFrame(v2UpdateChannelError, new(v2Encoder).u32(update.channelID).str("invalid-channel-id"))
+	}
+
+	if channel.applyMaxTarget(update.maxTarget) {
+		return channel.sendTarget(channel.session.vardiff.difficulty())
+	}
+	return nil
+}
+
+func (connection *v2Connection) submitShares(payload []byte) error {
+	submit, err := decodeV2SubmitSharesStandard(payload)
+	if err != nil {
+		markMalformedRequest(connection.client, payload)
+		return err
+	}
+
+	channel, exists := connection.channel(submit.channelID)
+	if !exists {
+		rejection := new(v2Encoder).u32(submit.channelID).u32(submit.sequenceNumber).str("invalid-channel-id")
+		return connection.sendFrame(v2SubmitSharesError, rejection)
+	}
+
+	session := channel.session
+	pool := connection.pool
+	difficulty := session.vardiff.difficulty()
+
+	submission := shareSubmission{
+		jobID:        fmt.Sprintf("%08x", submit.jobID),
+		extranonce2:  v2Extranonce2,
+		nonce:        fmt.Sprintf("%08x", submit.nonce),
+		nonceTime:    fmt.Sprintf("%08x", submit.nonceTime),
+		versionBits:  submit.version & session.versionRollingMask,
+		versionKey:   fmt.Sprintf("%08x", submit.version),
+		minerAddress: session.minerAddress,
+		rigID:        session.workerName,
+	}
+
+	// V2 sends the whole version, anything rolled outside the mask is invalid
+	var shareErr error
+	job, exists := pool.jobs.get(submission.jobID)
+	if exists && (submit.version^uint32(job.Template.Version))&^session.versionRollingMask != 0 {
+		m := "version %08x outside of mask %08x from %v"
+		shareErr = fmt.Errorf(m, submit.version, session.versionRollingMask, session.ip)
+	} else {
+		shareErr = pool.processShare(session, submission)
+	}
+
+	rejection, err := pool.settleShare(session, shareErr)
+	if err != nil {
+		return err
+	}
+	if rejection != nil {
+		reply := new(v2Encoder).u32(channel.id).u32(submit.sequenceNumber).str(v2ShareErrorCode(rejection.Code))
+		return connection.sendFrame(v2SubmitSharesError, reply)
+	}
+
+	reply := new(v2Encoder).u32(channel.id).u32(submit.sequenceNumber).u32(1).u64(uint64(difficulty))
+	return connection.sendFrame(v2SubmitSharesSuccess, reply)
+}
+
+func v2ShareErrorCode(code int) string {
+	switch code {
+	case stratumErrorJobNotFound:
+		return "stale-share"
+	case stratumErrorDuplicate:
+		return "duplicate-share"
+	case stratumErrorLowDifficulty:
+		return "difficulty-too-low"
+	case stratumErrorUnauthorized:
+		return "unauthorized"
+	default:
+		return "invalid-share"
+	}
+}
+
+func (connection *v2Connection) channel(channelID uint32) (*v2Channel, bool) {
+	connection.Lock()
+	defer connection.Unlock()
+	channel, exists := connection.channels[channelID]
+	return channel, exists
+}
+
+func (connection *v2Connection) allChannels() []*v2Channel {
+	connection.Lock()
+	defer connection.Unlock()
+
+	channels := make([]*v2Channel, 0, len(connection.channels))
+	for _, channel := range connection.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+func (connection *v2Connection) closeChannel(channelID uint32) {
+	connection.Lock()
+	channel, exists := connection.channels[channelID]
+	delete(connection.channels, channelID)
+	connection.Unlock()
+
+	if exists {
+		releaseExtranonce(channel.session.getExtranonce1())
+		if channel.counted {
+			numberOfConnections.Add(-1)
+			channel.session.port.connections.Add(-1)
+		}
+	}
+}
+
+// Channels after a connection's first are miners too, they count toward the pool's and port's max_connections
+func (pool *PoolServer) reserveChannelSlot(port *stratumPort) bool {
+	if pool.config.MaxConnections > 0 && numberOfConnections.Load() >= int64(pool.config.MaxConnections) {
+		return false
+	}
+	if port.config.MaxConnections > 0 && port.connections.Load() >= int64(port.config.MaxConnections) {
+		return false
+	}
+	numberOfConnections.Add(1)
+	port.connections.Add(1)
+	return true
+}
+
+func (connection *v2Connection) close() {
+	removeV2Connection(connection)
+	for _, channel := range connection.allChannels() {
+		connection.closeChannel(channel.id)
+	}
+}
+
+// Raises the channel's difficulty if its current target is above what the miner accepts
+func (channel *v2Channel) applyMaxTarget(maxTarget []byte) bool {
+	maximum := new(big.Int).SetBytes(reverse(maxTarget))
+	if maximum.Sign() == 0 {
+		return false
+	}
+
+	target := bitcoin.Target(maximum.Text(16))
+	minimum, _ := target.ToDifficulty()
+	minimum = minimum * channel.connection.pool.shareMultiplier()
+
+	vardiff := channel.session.vardiff
+	before := vardiff.difficulty()
+	return vardiff.setMinimum(minimum) != before
+}
+
+// U256 little endian, the same normalization validateAndWeighShare uses
+func (channel *v2Channel) target(difficulty float64) []byte {
+	target, _ := bitcoin.TargetFromDifficulty(difficulty / channel.connection.pool.shareMultiplier())
+	targetBig, _ := target.ToBig()
+	if targetBig.BitLen() > 256 {
+		return bytesOf(0xff, 32)
+	}
+	return reverse(targetBig.FillBytes(make([]byte, 32)))
+}
+
+func (channel *v2Channel) sendTarget(difficulty float64) error {
+	message := new(v2Encoder).u32(channel.id).u256(channel.target(difficulty))
+	return channel.connection.sendFrame(v2SetTarget, message)
+}
+
+// NewMiningJob, plus SetNewPrevHash when the job is on a new block
+func (channel *v2Channel) sendJob(work bitcoin.Work) error {
+	jobID := work[0].(string)
+	job, exists := channel.connection.pool.jobs.get(jobID)
+	if !exists {
+		return errors.New("job not registered: " + jobID)
+	}
+	jobNumber, err := strconv.ParseUint(jobID, 16, 32)
+	if err != nil {
+		return err
+	}
+
+	block := job.GetPrimary()
+	template := block.Template
+	merkleRoot, err := block.MerkleRoot(channel.session.getExtranonce1() + v2Extranonce2)
+	if err != nil {
+		return err
+	}
+	merkleRootBytes, err := hex.DecodeString(merkleRoot)
+	if err != nil {
+		return err
+	}
+	prevHash, err := hex.DecodeString(template.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+	bits, err := strconv.ParseUint(template.Bits, 16, 32)
+	if err != nil {
+		return err
+	}
+
+	channel.Lock()
+	defer channel.Unlock()
+
+	newBlock := channel.prevHash != template.PrevBlockHash
+	currentTime := uint32(template.CurrentTime)
+
+	var minTime *uint32 // None makes it a future job, activated by SetNewPrevHash
+	if !newBlock {
+		minTime = &currentTime
+	}
+
+	newJob := new(v2Encoder).
+		u32(channel.id).
+		u32(uint32(jobNumber)).
+		optionalU32(minTime).
+		u32(uint32(template.Version)).
+		bytes255(merkleRootBytes)
+	err = channel.connection.sendFrame(v2NewMiningJob, newJob)
+	if err != nil || !newBlock {
+		return err
+	}
+
+	setPrevHash := new(v2Encoder).
+		u32(channel.id).
+		u32(uint32(jobNumber)).
+		u256(reverse(prevHash)).
+		u32(currentTime).
+		u32(uint32(bits))
+	err = channel.connection.sendFrame(v2SetNewPrevHash, setPrevHash)
+	if err != nil {
+		return err
+	}
+
+	channel.prevHash = template.PrevBlockHash
+	return nil
+}
+
+// Retargets before the new job, like notifyAllSessions does for V1
+func notifyV2Channels(work bitcoin.Work) {
+	now := time.Now()
+	channels := 0
+	for _, connection := range allV2Connections() {
+		for _, channel := range connection.allChannels() {
+			vardiff := channel.session.vardiff
+			vardiff.clearPrevious()
+			newDifficulty, retargeted := vardiff.retarget(now)
+			if retargeted {
+				logOnError(channel.sendTarget(newDifficulty))
+			}
+
+			logOnError(channel.sendJob(work))
+			channels++
+		}
+	}
+	if channels > 0 {
+		log.Printf("Queued work for %v stratum v2 channel(s)", channels)
+	}
+}
+
+// Without a host, miners reconnect to the address they're already using
+func (connection *v2Connection) reconnect(host string, port uint16) error {
+	return connection.sendFrame(v2Reconnect, new(v2Encoder).str(host).u16(port))
+}
+
+func (pool *PoolServer) shareMultiplier() float64 {
+	return bitcoin.GetChain(pool.config.GetPrimary()).ShareMultiplier()
+}
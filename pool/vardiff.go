@@ -0,0 +1,172 @@
+package pool
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"designs.capital/dogepool/config"
+)
+
+// Largest factor a single retarget may move a session's difficulty by
+const vardiffMaxStep = 4
+
+type vardiff struct {
+	sync.Mutex
+	enabled      bool
+	current      float64
+	previous     float64 // Still accepted until the next job, miners may have shares in flight
+	min          float64
+	max          float64
+	targetTime   time.Duration
+	retargetTime time.Duration
+	variance     float64
+	windowStart  time.Time
+	windowShares int
+}
+
+func newVardiff(cfg config.VardiffConfig, startingDifficulty float64) *vardiff {
+	v := &vardiff{
+		enabled:     cfg.Enabled,
+		current:     startingDifficulty,
+		min:         cfg.MinDifficulty,
+		max:         cfg.MaxDifficulty,
+		variance:    cfg.VariancePercent / 100,
+		windowStart: time.Now(),
+	}
+
+	if v.enabled {
+		v.targetTime = mustParseDuration(cfg.TargetShareTime)
+		v.retargetTime = mustParseDuration(cfg.RetargetTime)
+		v.current = v.clamp(startingDifficulty)
+	}
+
+	return v
+}
+
+func (v *vardiff) difficulty() float64 {
+	v.Lock()
+	defer v.Unlock()
+	return v.current
+}
+
+func (v *vardiff) previousDifficulty() float64 {
+	v.Lock()
+	defer v.Unlock()
+	return v.previous
+}
+
+// New work has been sent, so shares at the old difficulty are no longer in flight
+func (v *vardiff) clearPrevious() {
+	v.Lock()
+	v.previous = 0
+	v.Unlock()
+}
+
+// Raises the session's floor, I.e. from a BIP310 minimum-difficulty request
+func (v *vardiff) setMinimum(minimum float64) float64 {
+	v.Lock()
+	defer v.Unlock()
+
+	if minimum > v.min {
+		v.min = minimum
+		if v.max > 0 && v.min > v.max {
+			v.min = v.max
+		}
+	}
+	if v.current < v.min {
+		v.current = v.min
+	}
+
+	return v.current
+}
+
+// A miner's preferred difficulty, kept within the port's bounds. Fixed difficulty ports ignore it
+func (v *vardiff) suggest(difficulty float64) (float64, bool) {
+	v.Lock()
+	defer v.Unlock()
+
+	if !v.enabled || !(difficulty > 0) || math.IsInf(difficulty, 1) {
+		return v.current, false
+	}
+
+	newDifficulty := v.clamp(difficulty)
+	if newDifficulty == v.current {
+		return v.current, false
+	}
+
+	v.previous = v.current
+	v.current = newDifficulty
+	v.windowStart = time.Now()
+	v.windowShares = 0
+
+	return v.current, true
+}
+
+func (v *vardiff) recordShare(now time.Time) (float64, bool) {
+	v.Lock()
+	defer v.Unlock()
+	v.windowShares++
+	return v.retargetLocked(now)
+}
+
+// Called on new work too, so sessions that stopped submitting can still be lowered
+func (v *vardiff) retarget(now time.Time) (float64, bool) {
+	v.Lock()
+	defer v.Unlock()
+	return v.retargetLocked(now)
+}
+
+func (v *vardiff) retargetLocked(now time.Time) (float64, bool) {
+	if !v.enabled {
+		return v.current, false
+	}
+
+	elapsed := now.Sub(v.windowStart)
+	if elapsed < v.retargetTime {
+		return v.current, false
+	}
+
+	// No shares in the window means we're at least this slow
+	shares := v.windowShares
+	if shares < 1 {
+		shares = 1
+	}
+	averageShareTime := elapsed.Seconds() / float64(shares)
+	targetTime := v.targetTime.Seconds()
+
+	v.windowStart = now
+	v.windowShares = 0
+
+	drift := (averageShareTime - targetTime) / targetTime
+	if drift <= v.variance && drift >= -v.variance {
+		return v.current, false
+	}
+
+	step := targetTime / averageShareTime
+	if step > vardiffMaxStep {
+		step = vardiffMaxStep
+	} else if step < 1.0/vardiffMaxStep {
+		step = 1.0 / vardiffMaxStep
+	}
+
+	newDifficulty := v.clamp(v.current * step)
+	if newDifficulty == v.current {
+		return v.current, false
+	}
+
+	v.previous = v.current
+	v.current = newDifficulty
+
+	return v.current, true
+}
+
+func (v *vardiff) clamp(difficulty float64) float64 {
+	if difficulty < v.min {
+		return v.min
+	}
+	if v.max > 0 && difficulty > v.max {
+		return v.max
+	}
+	return difficulty
+}
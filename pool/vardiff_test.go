@@ -0,0 +1,153 @@
+package pool
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"designs.capital/dogepool/config"
+)
+
+var testVardiffConfig = config.VardiffConfig{
+	Enabled:         true,
+	MinDifficulty:   1,
+	MaxDifficulty:   1024,
+	TargetShareTime: "10s",
+	RetargetTime:    "60s",
+	VariancePercent: 30,
+}
+
+// Target one share every 10s, retargeting every 60s within 30%
+func TestVardiffRetarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		disabled   bool
+		start      float64
+		elapsed    time.Duration
+		shares     int
+		difficulty float64
+		retargeted bool
+	}{
+		{name: "window not over", start: 64, elapsed: 59 * time.Second, shares: 60, difficulty: 64},
+		{name: "on target", start: 64, elapsed: time.Minute, shares: 6, difficulty: 64},
+		{name: "within variance", start: 64, elapsed: time.Minute, shares: 8, difficulty: 64},
+		{name: "twice as fast", start: 64, elapsed: time.Minute, shares: 12, difficulty: 128, retargeted: true},
+		{name: "half as fast", start: 64, elapsed: time.Minute, shares: 3, difficulty: 32, retargeted: true},
+		{name: "step capped up", start: 64, elapsed: time.Minute, shares: 60, difficulty: 256, retargeted: true},
+		{name: "no shares, step capped down", start: 64, elapsed: time.Minute, shares: 0, difficulty: 16, retargeted: true},
+		{name: "clamped to max", start: 512, elapsed: time.Minute, shares: 60, difficulty: 1024, retargeted: true},
+		{name: "clamped to min", start: 2, elapsed: time.Minute, shares: 0, difficulty: 1, retargeted: true},
+		{name: "already at max", start: 1024, elapsed: time.Minute, shares: 60, difficulty: 1024},
+		{name: "already at min", start: 1, elapsed: time.Minute, shares: 0, difficulty: 1},
+		{name: "disabled", disabled: true, start: 64, elapsed: time.Minute, shares: 60, difficulty: 64},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testVardiffConfig
+			cfg.Enabled = !test.disabled
+			v := newVardiff(cfg, test.start)
+
+			start := time.Now()
+			v.windowStart = start
+			v.windowShares = test.shares
+
+			difficulty, retargeted := v.retarget(start.Add(test.elapsed))
+			if difficulty != test.difficulty || retargeted != test.retargeted {
+				t.Fatalf("difficulty %v retargeted %v, expected %v %v", difficulty, retargeted, test.difficulty, test.retargeted)
+			}
+			if retargeted && v.previousDifficulty() != test.start {
+				t.Errorf("previous difficulty %v, expected %v", v.previousDifficulty(), test.start)
+			}
+			if !retargeted && v.previousDifficulty() != 0 {
+				t.Errorf("previous difficulty %v without a retarget", v.previousDifficulty())
+			}
+		})
+	}
+}
+
+// Each share counts toward the window it lands in, the one that ends it triggers the retarget
+func TestVardiffRecordShare(t *testing.T) {
+	v := newVardiff(testVardiffConfig, 64)
+	start := time.Now()
+	v.windowStart = start
+
+	for i := 1; i < 12; i++ {
+		if _, retargeted := v.recordShare(start.Add(time.Duration(i) * 5 * time.Second)); retargeted {
+			t.Fatalf("retargeted after %v shares, inside the window", i)
+		}
+	}
+	difficulty, retargeted := v.recordShare(start.Add(time.Minute))
+	if !retargeted || difficulty != 128 {
+		t.Fatalf("difficulty %v retargeted %v after a window of 5s shares", difficulty, retargeted)
+	}
+	if v.windowShares != 0 || !v.windowStart.Equal(start.Add(time.Minute)) {
+		t.Errorf("window not restarted: %v shares since %v", v.windowShares, v.windowStart)
+	}
+}
+
+func TestVardiffClamp(t *testing.T) {
+	if v := newVardiff(testVardiffConfig, 100000); v.difficulty() != 1024 {
+		t.Errorf("starting difficulty %v, expected the max", v.difficulty())
+	}
+	if v := newVardiff(testVardiffConfig, 0.5); v.difficulty() != 1 {
+		t.Errorf("starting difficulty %v, expected the min", v.difficulty())
+	}
+
+	disabled := testVardiffConfig
+	disabled.Enabled = false
+	if v := newVardiff(disabled, 100000); v.difficulty() != 100000 {
+		t.Errorf("fixed difficulty %v, expected it left alone", v.difficulty())
+	}
+
+	unbounded := testVardiffConfig
+	unbounded.MaxDifficulty = 0
+	if v := newVardiff(unbounded, 100000); v.difficulty() != 100000 {
+		t.Errorf("difficulty %v, a max of 0 means no max", v.difficulty())
+	}
+}
+
+func TestVardiffSuggest(t *testing.T) {
+	tests := []struct {
+		suggested  float64
+		difficulty float64
+		changed    bool
+	}{
+		{suggested: 256, difficulty: 256, changed: true},
+		{suggested: 64, difficulty: 64},
+		{suggested: 1 << 20, difficulty: 1024, changed: true},
+		{suggested: 0.001, difficulty: 1, changed: true},
+		{suggested: 0, difficulty: 64},
+		{suggested: -8, difficulty: 64},
+		{suggested: math.NaN(), difficulty: 64},
+		{suggested: math.Inf(1), difficulty: 64},
+	}
+
+	for _, test := range tests {
+		v := newVardiff(testVardiffConfig, 64)
+		difficulty, changed := v.suggest(test.suggested)
+		if difficulty != test.difficulty || changed != test.changed {
+			t.Errorf("suggested %v: difficulty %v changed %v, expected %v %v", test.suggested, difficulty, changed, test.difficulty, test.changed)
+		}
+	}
+
+	disabled := testVardiffConfig
+	disabled.Enabled = false
+	if difficulty, changed := newVardiff(disabled, 64).suggest(256); changed || difficulty != 64 {
+		t.Errorf("fixed difficulty port took a suggestion: %v", difficulty)
+	}
+}
+
+// BIP310's minimum-difficulty raises the floor, never past the max
+func TestVardiffSetMinimum(t *testing.T) {
+	v := newVardiff(testVardiffConfig, 64)
+	if difficulty := v.setMinimum(128); difficulty != 128 {
+		t.Errorf("difficulty %v after a minimum of 128", difficulty)
+	}
+	if difficulty := v.setMinimum(32); difficulty != 128 {
+		t.Errorf("difficulty %v after a lower minimum", difficulty)
+	}
+	if difficulty := v.setMinimum(4096); difficulty != 1024 {
+		t.Errorf("difficulty %v after a minimum over the max", difficulty)
+	}
+}
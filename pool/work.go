@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,25 +16,28 @@ import (
 func (p *PoolServer) fetchRpcBlockTemplatesAndCacheWork() error {
 	var block *bitcoin.BitcoinBlock
 	var err error
-	template, auxblock, err := p.fetchAllBlockTemplatesFromRPC()
+	template, auxBlocks, err := p.fetchAllBlockTemplatesFromRPC()
 	if err != nil {
 		// Switch nodes if we fail to get work
 		err = p.CheckAndRecoverRPCs()
 		if err != nil {
 			return err
 		}
-		template, auxblock, err = p.fetchAllBlockTemplatesFromRPC()
+		template, auxBlocks, err = p.fetchAllBlockTemplatesFromRPC()
 		if err != nil {
 			return err
 		}
 	}
 
 	auxillary := p.config.BlockSignature
-	if auxblock != nil {
-		mergedPOW := auxblock.GetWork()
-		auxillary = auxillary + hexStringToByteString(mergedPOW)
-
-		p.templates.AuxBlocks = []bitcoin.AuxBlock{*auxblock}
+	p.templates.AuxBlocks = auxBlocks
+	p.templates.AuxMerkle = nil
+	if len(auxBlocks) > 0 {
+		p.templates.AuxMerkle, err = bitcoin.MakeAuxMerkleTree(auxBlocks)
+		if err != nil {
+			return err
+		}
+		auxillary = auxillary + hexStringToByteString(p.templates.AuxMerkle.Commitment())
 	}
 
 	primaryName := p.config.GetPrimary()
@@ -41,7 +45,7 @@ func (p *PoolServer) fetchRpcBlockTemplatesAndCacheWork() error {
 	rewardPubScriptKey := p.GetPrimaryNode().RewardPubScriptKey
 	extranonceByteReservationLength := 8
 
-	block, p.workCache, err = bitcoin.GenerateWork(&template, auxblock,
+	block, p.workCache, err = bitcoin.GenerateWork(&template,
 		primaryName, auxillary, rewardPubScriptKey,
 		extranonceByteReservationLength)
 	if err != nil {
@@ -50,69 +54,189 @@ func (p *PoolServer) fetchRpcBlockTemplatesAndCacheWork() error {
 
 	p.templates.BitcoinBlock = *block
 
+	jobID := p.workCache[0].(string)
+	p.jobs.add(jobID, p.templates)
+
 	return nil
 }
 
-// Main OUTPUT
+// Protocol neutral share, both stratum versions are validated and credited through processShare
+type shareSubmission struct {
+	jobID        string
+	extranonce2  string
+	nonce        string
+	nonceTime    string
+	versionBits  uint32 // Only the bits inside the session's rolling mask are used
+	versionKey   string // Rolled version as 8 hex characters, part of the duplicate check
+	minerAddress string
+	rigID        string
+}
+
 func (p *PoolServer) recieveWorkFromClient(share bitcoin.Work, client *stratumClient) error {
-	primaryBlockTemplate := p.templates.GetPrimary()
+	if len(share) < 5 {
+		return errors.New("not enough share parameters from " + client.ip)
+	}
+	for _, param := range share[:5] {
+		if _, isString := param.(string); !isString {
+			return errors.New("share parameters must be strings from " + client.ip)
+		}
+	}
+
+	var slots bitcoin.BitcoinBlock // Submission slots don't depend on the template
+	extranonce2Slot, _ := slots.Extranonce2SubmissionSlot()
+	submission := shareSubmission{
+		jobID:        share[1].(string),
+		extranonce2:  share[extranonce2Slot].(string),
+		nonce:        share[slots.NonceSubmissionSlot()].(string),
+		nonceTime:    share[slots.NonceTimeSubmissionSlot()].(string),
+		minerAddress: client.minerAddress, // miningSubmit checked share[0] matches the session
+		rigID:        client.workerName,
+	}
+
+	if len(share) > 5 {
+		versionHex, _ := share[5].(string)
+		rolled, err := strconv.ParseUint(versionHex, 16, 32)
+		if err != nil {
+			return errors.New("invalid version bits from " + client.ip)
+		}
+		submission.versionBits = uint32(rolled)
+		submission.versionKey = fmt.Sprintf("%08x", rolled)
+		if submission.versionBits&^client.versionRollingMask != 0 {
+			m := "version bits %v outside of mask %08x from %v"
+			return fmt.Errorf(m, versionHex, client.versionRollingMask, client.ip)
+		}
+	}
+
+	return p.processShare(client, submission)
+}
+
+// Against the session's difficulty, or its last one if the miner may not have switched yet
+func weighSessionShare(client *stratumClient, primary *bitcoin.BitcoinBlock, auxBlocks []bitcoin.AuxBlock) (int, []int, float64) {
+	sessionDifficulty := client.vardiff.difficulty()
+	shareStatus, auxCandidates, shareDifficulty := validateAndWeighShare(primary, auxBlocks, sessionDifficulty)
+	if shareStatus == shareInvalid {
+		previousDifficulty := client.vardiff.previousDifficulty()
+		if previousDifficulty > 0 && previousDifficulty < sessionDifficulty {
+			shareStatus, auxCandidates, shareDifficulty = validateAndWeighShare(primary, auxBlocks, previousDifficulty)
+		}
+	}
+	return shareStatus, auxCandidates, shareDifficulty
+}
+
+// Main OUTPUT
+func (p *PoolServer) processShare(client *stratumClient, submission shareSubmission) error {
+	jobID := submission.jobID
+	job, exists := p.jobs.get(jobID)
+	if !exists {
+		m := "job %v not found for share from %v"
+		log.Printf(m, jobID, client.ip)
+		return newStratumError(stratumErrorJobNotFound)
+	}
+
+	primaryBlockTemplate := job.GetPrimary()
 	if primaryBlockTemplate.Template == nil {
 		return errors.New("primary block template not yet set")
 	}
-	auxBlock := p.templates.GetAux1()
+	auxBlocks := job.AuxBlocks
 
 	var err error
 
-	// TODO - this key and interface isn't very invertable..
-	workerString := share[0].(string)
-	workerStringParts := strings.Split(workerString, ".")
-	if len(workerStringParts) < 2 {
-		return errors.New("invalid miner address")
+	// Fixed width lowercase hex, so a padded or uppercased resubmit can't dodge the duplicate check
+	submission.extranonce2 = strings.ToLower(submission.extranonce2)
+	submission.nonce = strings.ToLower(submission.nonce)
+	submission.nonceTime = strings.ToLower(submission.nonceTime)
+	if !isHexOfLength(submission.extranonce2, extranonce2Length) {
+		return fmt.Errorf("extranonce2 %v is not %v bytes of hex from %v", submission.extranonce2, extranonce2Length, client.ip)
+	}
+	if !isHexOfLength(submission.nonce, 4) || !isHexOfLength(submission.nonceTime, 4) {
+		return fmt.Errorf("nonce %v and ntime %v must be 8 hex characters from %v", submission.nonce, submission.nonceTime, client.ip)
 	}
-	minerAddress := workerStringParts[0]
-	rigID := workerStringParts[1]
+
+	minerAddress := submission.minerAddress
+	rigID := submission.rigID
 
 	primaryBlockHeight := primaryBlockTemplate.Template.Height
-	nonce := share[primaryBlockTemplate.NonceSubmissionSlot()].(string)
-	extranonce2Slot, _ := primaryBlockTemplate.Extranonce2SubmissionSlot()
-	extranonce2 := share[extranonce2Slot].(string)
-	nonceTime := share[primaryBlockTemplate.NonceTimeSubmissionSlot()].(string)
+	nonce := submission.nonce
+	nonceTime := submission.nonceTime
 
-	// TODO - validate input
+	// Shares mined before a ReassignExtranonce still carry the old extranonce1
+	extranonce1s := []string{client.getExtranonce1()}
+	if previous, exists := client.previousExtranonce(p.jobs.currentID()); exists {
+		extranonce1s = append(extranonce1s, previous)
+	}
 
-	extranonce := client.extranonce1 + extranonce2
+	versionBits := submission.versionBits
+	versionBitsHex := submission.versionKey
 
-	_, err = primaryBlockTemplate.MakeHeader(extranonce, nonce, nonceTime)
+	var extranonce string
+	var shareStatus int
+	var auxCandidates []int
+	var shareDifficulty float64
+	for _, extranonce1 := range extranonce1s {
+		extranonce = extranonce1 + submission.extranonce2
+		_, err = primaryBlockTemplate.MakeHeader(extranonce, nonce, nonceTime, versionBits, client.versionRollingMask)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
+		shareStatus, auxCandidates, shareDifficulty = weighSessionShare(client, &primaryBlockTemplate, auxBlocks)
+		if shareStatus != shareInvalid {
+			break
+		}
 	}
 
-	shareStatus, shareDifficulty := validateAndWeighShare(&primaryBlockTemplate, auxBlock, p.config.PoolDifficulty)
+	if !job.firstSubmission(extranonce, nonceTime, nonce, versionBitsHex) {
+		m := "Duplicate share for job %v from %v [%v]"
+		log.Printf(m, jobID, client.ip, rigID)
+		return newStratumError(stratumErrorDuplicate)
+	}
 
-	heightMessage := fmt.Sprintf("%v", primaryBlockHeight)
-	if shareStatus == dualCandidate {
-		heightMessage = fmt.Sprintf("%v,%v", primaryBlockHeight, auxBlock.Height)
-	} else if shareStatus == aux1Candidate {
-		heightMessage = fmt.Sprintf("%v", auxBlock.Height)
+	var heights []string
+	if shareStatus != auxCandidate {
+		heights = append(heights, fmt.Sprintf("%v", primaryBlockHeight))
+	}
+	for _, i := range auxCandidates {
+		heights = append(heights, fmt.Sprintf("%v", auxBlocks[i].Height))
 	}
+	heightMessage := strings.Join(heights, ",")
 
 	if shareStatus == shareInvalid {
 		m := "❔ Invalid share for block %v from %v [%v] [%v]"
-		m = fmt.Sprintf(m, heightMessage, client.ip, rigID, client.userAgent)
-		return errors.New(m)
+		log.Printf(m, heightMessage, client.ip, rigID, client.userAgent)
+		return newStratumError(stratumErrorLowDifficulty)
+	}
+
+	if shareStatus > shareValid {
+		primaryStale, staleAux := p.jobs.staleChains(job)
+		primary := shareStatus == primaryCandidate || shareStatus == dualCandidate
+		if primary && primaryStale {
+			m := "Primary block candidate for block %v from %v [%v] is on a previous tip, not submitting"
+			log.Printf(m, primaryBlockHeight, client.ip, rigID)
+			primary = false
+		}
+
+		var freshCandidates []int
+		for _, i := range auxCandidates {
+			if staleAux[auxBlocks[i].ChainName] {
+				m := "%v block candidate for block %v from %v [%v] is on a previous tip, not submitting"
+				log.Printf(m, auxBlocks[i].ChainName, auxBlocks[i].Height, client.ip, rigID)
+				continue
+			}
+			freshCandidates = append(freshCandidates, i)
+		}
+		auxCandidates = freshCandidates
+		shareStatus = candidateStatus(primary, len(auxCandidates) > 0)
 	}
 
 	m := "Valid share for block %v from %v [%v]"
 	m = fmt.Sprintf(m, heightMessage, client.ip, rigID)
 	log.Println(m)
 
-	blockTarget := bitcoin.Target(primaryBlockTemplate.Template.Target)
-	blockDifficulty, _ := blockTarget.ToDifficulty()
+	blockDifficulty, err := bitcoin.DifficultyFromBits(primaryBlockTemplate.Template.Bits)
+	logOnError(err)
 	blockDifficulty = blockDifficulty * primaryBlockTemplate.ShareMultiplier()
 
-	p.Lock()
-	p.shareBuffer = append(p.shareBuffer, persistence.Share{
+	err = p.bufferShare(persistence.Share{
 		PoolID:            p.config.PoolName,
 		BlockHeight:       primaryBlockHeight,
 		Miner:             minerAddress,
@@ -121,9 +245,21 @@ func (p *PoolServer) recieveWorkFromClient(share bitcoin.Work, client *stratumCl
 		Difficulty:        shareDifficulty,
 		NetworkDifficulty: blockDifficulty,
 		IpAddress:         client.ip,
+		Port:              client.port.label(),
 		Created:           time.Now(),
 	})
-	p.Unlock()
+	if err != nil {
+		log.Println("Failed to journal share from " + client.ip + ": " + err.Error())
+		return newStratumError(stratumErrorOther)
+	}
+	p.hashrates.record(minerAddress, rigID, shareDifficulty)
+
+	newDifficulty, retargeted := client.vardiff.recordShare(time.Now())
+	if retargeted {
+		log.Printf("Vardiff retargeted %v [%v] to difficulty %v", client.ip, rigID, newDifficulty)
+		err = client.setDifficulty(p, newDifficulty)
+		logOnError(err)
+	}
 
 	if shareStatus == shareValid {
 		return nil
@@ -145,41 +281,42 @@ func (p *PoolServer) recieveWorkFromClient(share bitcoin.Work, client *stratumCl
 		Source:               "",
 	}
 
-	aux1Name := p.config.GetAux1()
-	if aux1Name != "" && shareStatus >= aux1Candidate {
-		err = p.submitAuxBlock(primaryBlockTemplate, *auxBlock)
+	// Each aux chain is submitted on its own, one rejecting doesn't cost us the others
+	for _, i := range auxCandidates {
+		auxBlock := auxBlocks[i]
+		err = p.submitAuxBlock(primaryBlockTemplate, job.Pair, i)
 		if err != nil {
 			// Try to submit on different node
-			err = p.rpcManagers[p.config.GetAux1()].CheckAndRecoverRPCs()
-			if err != nil {
-				return err
+			err = p.rpcManagers[auxBlock.ChainName].CheckAndRecoverRPCs()
+			if err == nil {
+				err = p.submitAuxBlock(primaryBlockTemplate, job.Pair, i)
 			}
-			err = p.submitBlockToChain(primaryBlockTemplate)
 		}
 
 		if err != nil {
 			log.Println(err)
-		} else {
-			// EnrichShare
-			aux1Target := bitcoin.Target(reverseHexBytes(auxBlock.Target))
-			aux1Difficulty, _ := aux1Target.ToDifficulty()
-			aux1Difficulty = aux1Difficulty * bitcoin.GetChain(aux1Name).ShareMultiplier()
+			continue
+		}
 
-			found.Chain = aux1Name
-			found.Created = time.Now()
-			found.Hash = auxBlock.Hash
-			found.NetworkDifficulty = aux1Difficulty
-			found.BlockHeight = uint(auxBlock.Height)
-			// Likely doesn't exist on your AUX coin API unless you editted the daemon source to return this
-			found.TransactionConfirmationData = reverseHexBytes(auxBlock.CoinbaseHash)
+		// EnrichShare
+		auxDifficulty, err := bitcoin.DifficultyFromBits(auxBlock.Bits)
+		logOnError(err)
+		auxDifficulty = auxDifficulty * bitcoin.GetChain(auxBlock.ChainName).ShareMultiplier()
 
-			err = persistence.Blocks.Insert(found)
-			if err != nil {
-				log.Println(err)
-			}
+		found.Chain = auxBlock.ChainName
+		found.Created = time.Now()
+		found.Hash = auxBlock.Hash
+		found.NetworkDifficulty = auxDifficulty
+		found.BlockHeight = uint(auxBlock.Height)
+		// Likely doesn't exist on your AUX coin API unless you editted the daemon source to return this
+		found.TransactionConfirmationData = reverseHexBytes(auxBlock.CoinbaseHash)
 
-			successStatus = aux1Candidate
+		err = persistence.Blocks.Insert(found)
+		if err != nil {
+			log.Println(err)
 		}
+
+		successStatus = auxCandidate
 	}
 
 	if shareStatus == dualCandidate || shareStatus == primaryCandidate {
@@ -214,7 +351,7 @@ func (p *PoolServer) recieveWorkFromClient(share bitcoin.Work, client *stratumCl
 				log.Println(err)
 			}
 			found.Chain = ""
-			if successStatus == aux1Candidate {
+			if successStatus == auxCandidate {
 				successStatus = dualCandidate
 			} else {
 				successStatus = primaryCandidate
@@ -105,12 +105,16 @@ func (r *RPCClient) GetPeerCount() (int64, error) { // getconnectioncount
 }
 
 func (r *RPCClient) GetBlockTemplate() (json.RawMessage, error) {
+	return r.GetBlockTemplateWithRules([]string{"mweb", "segwit"})
+}
+
+// Rules are the softforks we support, I.e. "segwit". Chains without any still need an empty list
+func (r *RPCClient) GetBlockTemplateWithRules(rules []string) (json.RawMessage, error) {
+	if rules == nil {
+		rules = []string{}
+	}
 	params := make([]interface{}, 1)
-	rules := make(map[string][]string)
-	rules["rules"] = make([]string, 2)
-	rules["rules"][0] = "mweb"
-	rules["rules"][1] = "segwit"
-	params[0] = rules
+	params[0] = map[string][]string{"rules": rules}
 	resp, status, err := r.doRequest("getblocktemplate", params)
 	if err != nil {
 		return json.RawMessage{}, err
@@ -265,30 +269,28 @@ func (r *RPCClient) SubmitAuxBlock(auxBlockHash string, primaryAuxPow string) (b
 	return true, nil
 }
 
-type validateAddressResponse struct {
-	ScriptPubKey string `json:"scriptPubKey"`
-}
-
-func (r *RPCClient) ValidateAddress(address string) (validateAddressResponse, error) {
-	var response validateAddressResponse
-
-	rpcParams := make([]interface{}, 1)
+// Proves the holder of a legacy address signed message, I.e. from signmessage in a wallet
+func (r *RPCClient) VerifyMessage(address, signature, message string) (bool, error) {
+	rpcParams := make([]interface{}, 3)
 	rpcParams[0] = address
+	rpcParams[1] = signature
+	rpcParams[2] = message
 
-	resp, status, err := r.doRequest("validateaddress", rpcParams)
+	resp, status, err := r.doRequest("verifymessage", rpcParams)
 	if err != nil {
-		return response, err
+		return false, err
 	}
 	if status != 200 {
-		return response, errors.New("RPC: `validateaddress` failed HTTP 200")
+		return false, handleHttpError(resp, status) // Malformed signatures come back as errors
 	}
 
-	err = json.Unmarshal(resp.Result, &response)
+	var verified bool
+	err = json.Unmarshal(resp.Result, &verified)
 	if err != nil {
-		return response, err
+		return false, err
 	}
 
-	return response, nil
+	return verified, nil
 }
 
 type blockChainInfoResponse struct {